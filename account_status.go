@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sam-maton/chirpy/internal/database"
+)
+
+// accountStatusCacheTTL is kept short because middlewareAuth relies on it to
+// stop existing JWTs working. Suspensions also clear the user's entry on every
+// server through a user.updated event.
+const accountStatusCacheTTL = 30 * time.Second
+
+// accountStatus is the part of a user that decides whether they can use
+// their account at all.
+type accountStatus struct {
+	SuspendedUntil sql.NullTime
+	Banned         bool
+	Reason         sql.NullString
+}
+
+func accountStatusFromUser(user database.User) accountStatus {
+	return accountStatus{
+		SuspendedUntil: user.SuspendedUntil,
+		Banned:         user.BannedAt.Valid,
+		Reason:         user.SuspensionReason,
+	}
+}
+
+// disabled reports whether the account is banned or still suspended at now.
+func (s accountStatus) disabled(now time.Time) bool {
+	return s.Banned || (s.SuspendedUntil.Valid && now.Before(s.SuspendedUntil.Time))
+}
+
+func (s accountStatus) message() string {
+	message := "This account has been banned"
+	if !s.Banned {
+		message = "This account is suspended until " + s.SuspendedUntil.Time.UTC().Format(time.RFC3339)
+	}
+	if s.Reason.Valid {
+		message += ": " + s.Reason.String
+	}
+	return message
+}
+
+// accountStatusFor looks up whether the user is suspended or banned.
+func (cfg *apiConfig) accountStatusFor(ctx context.Context, userId uuid.UUID) (accountStatus, error) {
+	if status, ok := cfg.accountStatusCache.Get(userId); ok {
+		return status, nil
+	}
+
+	user, err := cfg.db.GetUserByID(ctx, userId)
+	if err != nil {
+		return accountStatus{}, err
+	}
+
+	status := accountStatusFromUser(user)
+	cfg.accountStatusCache.Set(userId, status)
+	return status, nil
+}
+
+// rejectDisabledAccount responds with a 403 and returns true when the user
+// can't log in or use their tokens.
+func rejectDisabledAccount(w http.ResponseWriter, status accountStatus) bool {
+	if !status.disabled(time.Now()) {
+		return false
+	}
+
+	respondWithError(w, status.message(), http.StatusForbidden, nil)
+	return true
+}
+
+// requireActiveAccount wraps an authenticated handler so requests made with
+// the token of a suspended or banned user are rejected.
+func (cfg *apiConfig) requireActiveAccount(handler func(http.ResponseWriter, *http.Request, uuid.UUID)) func(http.ResponseWriter, *http.Request, uuid.UUID) {
+	return func(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+		status, err := cfg.accountStatusFor(r.Context(), userId)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, "Invalid auth token", http.StatusUnauthorized, err)
+			return
+		}
+		if err != nil {
+			respondWithError(w, "There was an error checking the account", http.StatusInternalServerError, err)
+			return
+		}
+
+		if rejectDisabledAccount(w, status) {
+			return
+		}
+
+		handler(w, r, userId)
+	}
+}
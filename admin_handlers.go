@@ -1,11 +1,20 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sam-maton/chirpy/internal/auth"
+	"github.com/sam-maton/chirpy/internal/database"
 )
 
-func (cfg *apiConfig) handlerMetricHits(w http.ResponseWriter, r *http.Request) {
+func (cfg *apiConfig) handlerMetricHits(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
 	w.Header().Add("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(200)
 	// w.Write([]byte(fmt.Sprintf("Hits: %d", cfg.fileServerHits.Load())))
@@ -17,13 +26,367 @@ func (cfg *apiConfig) handlerMetricHits(w http.ResponseWriter, r *http.Request)
 	</html>`, cfg.fileServerHits.Load())
 }
 
-func (cfg *apiConfig) handlerReset(w http.ResponseWriter, r *http.Request) {
+func (cfg *apiConfig) handlerReset(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	// Reset deletes every user, so it is only ever allowed on a dev server.
+	if cfg.platform != "dev" {
+		respondWithError(w, "Reset is only allowed in dev environment", http.StatusForbidden, nil)
+		return
+	}
+
 	err := cfg.db.Reset(r.Context())
 
 	if err != nil {
 		respondWithError(w, "There was an error reseting the data", 400, err)
+		return
 	}
 	cfg.fileServerHits.Store(0)
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Hits reset to 0"))
 }
+
+func (cfg *apiConfig) handlerSetUserRole(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	type params struct {
+		Role string `json:"role"`
+	}
+
+	targetId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, "Not a valid ID", http.StatusBadRequest, err)
+		return
+	}
+
+	if targetId == userId {
+		respondWithError(w, "Admins cannot change their own role", http.StatusForbidden, nil)
+		return
+	}
+
+	p := params{}
+	decoder := json.NewDecoder(r.Body)
+	err = decoder.Decode(&p)
+	if err != nil {
+		respondWithError(w, paramsDecodeError, http.StatusBadRequest, err)
+		return
+	}
+
+	role, err := auth.ParseRole(p.Role)
+	if err != nil {
+		respondWithError(w, "Role must be one of user, moderator or admin", http.StatusBadRequest, err)
+		return
+	}
+
+	user, err := cfg.db.SetUserRole(r.Context(), database.SetUserRoleParams{
+		ID:   targetId,
+		Role: string(role),
+	})
+	if err != nil {
+		respondWithError(w, "There was an error updating the user's role", http.StatusNotFound, err)
+		return
+	}
+
+	respondWithJson(w, 200, user)
+}
+
+// SUSPENSION HANDLERS
+type accountStatusResponse struct {
+	ID               uuid.UUID  `json:"id"`
+	Email            string     `json:"email"`
+	SuspendedUntil   *time.Time `json:"suspended_until"`
+	BannedAt         *time.Time `json:"banned_at"`
+	SuspensionReason *string    `json:"suspension_reason"`
+}
+
+// handlerSuspendUser suspends a user for a number of days, or bans them
+// outright with "ban": true. Their refresh tokens are revoked, and their
+// access tokens stop working once the account status cache catches up.
+func (cfg *apiConfig) handlerSuspendUser(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	type params struct {
+		Reason string `json:"reason"`
+		Days   int    `json:"days"`
+		Ban    bool   `json:"ban"`
+	}
+
+	p := params{}
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&p)
+	if err != nil {
+		respondWithError(w, paramsDecodeError, http.StatusBadRequest, err)
+		return
+	}
+
+	if p.Reason == "" {
+		respondWithError(w, "A reason is required", http.StatusBadRequest, nil)
+		return
+	}
+
+	if p.Days == 0 {
+		p.Days = defaultSuspensionDays
+	}
+	if !p.Ban && (p.Days < 1 || p.Days > maxSuspensionDays) {
+		respondWithError(w, "days must be between 1 and 365", http.StatusBadRequest, nil)
+		return
+	}
+
+	action := actionSuspendUser
+	if p.Ban {
+		action = actionBanUser
+	}
+
+	cfg.changeAccountStatus(w, r, userId, action, p.Reason, func(ctx context.Context, qtx *database.Queries, targetId uuid.UUID) error {
+		reason := sql.NullString{String: p.Reason, Valid: true}
+
+		if p.Ban {
+			err := qtx.BanUser(ctx, database.BanUserParams{
+				ID:               targetId,
+				SuspensionReason: reason,
+			})
+			if err != nil {
+				return err
+			}
+		} else {
+			err := qtx.SuspendUser(ctx, database.SuspendUserParams{
+				ID:               targetId,
+				SuspendedUntil:   sql.NullTime{Time: time.Now().AddDate(0, 0, p.Days), Valid: true},
+				SuspensionReason: reason,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return qtx.RevokeUserRefreshTokens(ctx, targetId)
+	})
+}
+
+// handlerUnsuspendUser lifts a suspension or a ban.
+func (cfg *apiConfig) handlerUnsuspendUser(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	type params struct {
+		Reason string `json:"reason"`
+	}
+
+	p := params{}
+	// The body is optional when lifting a suspension.
+	if r.ContentLength != 0 {
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&p)
+		if err != nil {
+			respondWithError(w, paramsDecodeError, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	cfg.changeAccountStatus(w, r, userId, actionUnsuspendUser, p.Reason, func(ctx context.Context, qtx *database.Queries, targetId uuid.UUID) error {
+		return qtx.UnsuspendUser(ctx, targetId)
+	})
+}
+
+// changeAccountStatus runs apply against the user in the path and records it
+// in the moderation log, in one transaction. Admins can't change their own
+// status or another admin's.
+func (cfg *apiConfig) changeAccountStatus(w http.ResponseWriter, r *http.Request, adminId uuid.UUID, action, note string, apply func(context.Context, *database.Queries, uuid.UUID) error) {
+	targetId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, "Not a valid ID", http.StatusBadRequest, err)
+		return
+	}
+
+	if targetId == adminId {
+		respondWithError(w, "Admins cannot suspend themselves", http.StatusForbidden, nil)
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, "There was an error updating the user", http.StatusInternalServerError, err)
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := cfg.db.WithTx(tx)
+
+	target, err := qtx.GetUserByID(r.Context(), targetId)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, "User could not be found", http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, "There was an error getting the user", http.StatusInternalServerError, err)
+		return
+	}
+
+	if auth.Role(target.Role) == auth.RoleAdmin {
+		respondWithError(w, "Admins cannot be suspended", http.StatusForbidden, nil)
+		return
+	}
+
+	err = apply(r.Context(), qtx, targetId)
+	if err != nil {
+		respondWithError(w, "There was an error updating the user", http.StatusInternalServerError, err)
+		return
+	}
+
+	_, err = qtx.CreateModerationAction(r.Context(), database.CreateModerationActionParams{
+		ModeratorID:  uuid.NullUUID{UUID: adminId, Valid: true},
+		Action:       action,
+		TargetUserID: uuid.NullUUID{UUID: targetId, Valid: true},
+		Note:         sql.NullString{String: note, Valid: note != ""},
+	})
+	if err != nil {
+		respondWithError(w, "There was an error recording the moderation action", http.StatusInternalServerError, err)
+		return
+	}
+
+	target, err = qtx.GetUserByID(r.Context(), targetId)
+	if err != nil {
+		respondWithError(w, "There was an error getting the user", http.StatusInternalServerError, err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(w, "There was an error updating the user", http.StatusInternalServerError, err)
+		return
+	}
+
+	cfg.publishUserUpdated(r.Context(), targetId)
+
+	respondWithJson(w, 200, accountStatusResponse{
+		ID:               target.ID,
+		Email:            target.Email,
+		SuspendedUntil:   nullTimePtr(target.SuspendedUntil),
+		BannedAt:         nullTimePtr(target.BannedAt),
+		SuspensionReason: nullStringPtr(target.SuspensionReason),
+	})
+}
+
+// WEBHOOK EVENT HANDLERS
+type webhookEventResponse struct {
+	ID             uuid.UUID       `json:"id"`
+	ReceivedAt     time.Time       `json:"received_at"`
+	Source         string          `json:"source"`
+	SignatureValid bool            `json:"signature_valid"`
+	EventID        *string         `json:"event_id"`
+	EventType      *string         `json:"event_type"`
+	Outcome        string          `json:"outcome"`
+	Error          *string         `json:"error"`
+	ReplayOf       *uuid.UUID      `json:"replay_of"`
+	Headers        json.RawMessage `json:"headers,omitempty"`
+	Body           string          `json:"body,omitempty"`
+}
+
+func webhookEventToResponse(event database.WebhookEvent) webhookEventResponse {
+	return webhookEventResponse{
+		ID:             event.ID,
+		ReceivedAt:     event.ReceivedAt,
+		Source:         event.Source,
+		SignatureValid: event.SignatureValid,
+		EventID:        nullStringPtr(event.EventID),
+		EventType:      nullStringPtr(event.EventType),
+		Outcome:        event.Outcome,
+		Error:          nullStringPtr(event.Error),
+		ReplayOf:       nullUUIDPtr(event.ReplayOf),
+		Headers:        event.Headers,
+		Body:           string(event.Body),
+	}
+}
+
+func (cfg *apiConfig) handlerGetWebhookEvents(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	outcome := r.URL.Query().Get("outcome")
+
+	events, err := cfg.db.GetWebhookEvents(r.Context(), database.GetWebhookEventsParams{
+		Outcome: sql.NullString{String: outcome, Valid: outcome != ""},
+		Limit:   limit,
+		Offset:  offset,
+	})
+	if err != nil {
+		respondWithError(w, "There was an error getting the webhook events", http.StatusInternalServerError, err)
+		return
+	}
+
+	response := []webhookEventResponse{}
+	for _, event := range events {
+		response = append(response, webhookEventResponse{
+			ID:             event.ID,
+			ReceivedAt:     event.ReceivedAt,
+			Source:         event.Source,
+			SignatureValid: event.SignatureValid,
+			EventID:        nullStringPtr(event.EventID),
+			EventType:      nullStringPtr(event.EventType),
+			Outcome:        event.Outcome,
+			Error:          nullStringPtr(event.Error),
+			ReplayOf:       nullUUIDPtr(event.ReplayOf),
+		})
+	}
+
+	respondWithJson(w, 200, response)
+}
+
+func (cfg *apiConfig) handlerGetWebhookEvent(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	eventId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, "Not a valid ID", http.StatusBadRequest, err)
+		return
+	}
+
+	event, err := cfg.db.GetWebhookEvent(r.Context(), eventId)
+	if err != nil {
+		respondWithError(w, "Webhook event could not be found", http.StatusNotFound, err)
+		return
+	}
+
+	respondWithJson(w, 200, webhookEventToResponse(event))
+}
+
+// handlerReplayWebhookEvent runs a stored webhook through the same processing
+// as a new delivery. The replay is stored as its own event pointing back at
+// the original.
+func (cfg *apiConfig) handlerReplayWebhookEvent(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	eventId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, "Not a valid ID", http.StatusBadRequest, err)
+		return
+	}
+
+	original, err := cfg.db.GetWebhookEvent(r.Context(), eventId)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, "Webhook event could not be found", http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, "There was an error getting the webhook event", http.StatusInternalServerError, err)
+		return
+	}
+
+	// Anyone can get an unsigned body stored, so only bodies that really
+	// came from Polka are trusted enough to replay.
+	if !original.SignatureValid {
+		respondWithError(w, "Only webhooks with a valid signature can be replayed", http.StatusConflict, nil)
+		return
+	}
+
+	replay, err := cfg.db.CreateWebhookEvent(r.Context(), database.CreateWebhookEventParams{
+		Source:   original.Source,
+		Headers:  original.Headers,
+		Body:     original.Body,
+		ReplayOf: uuid.NullUUID{UUID: original.ID, Valid: true},
+	})
+	if err != nil {
+		respondWithError(w, "There was an error storing the replayed webhook", http.StatusInternalServerError, err)
+		return
+	}
+
+	cfg.handlePolkaEvent(r.Context(), replay.ID, replay.Body, true)
+
+	replay, err = cfg.db.GetWebhookEvent(r.Context(), replay.ID)
+	if err != nil {
+		respondWithError(w, "There was an error getting the replayed webhook", http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJson(w, 200, webhookEventToResponse(replay))
+}
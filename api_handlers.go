@@ -1,17 +1,25 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/sam-maton/chirpy/internal/auth"
 	"github.com/sam-maton/chirpy/internal/database"
+	"github.com/sam-maton/chirpy/internal/entitlements"
+	"github.com/sam-maton/chirpy/internal/spam"
 )
 
 const paramsDecodeError = "There was an error decoding the params"
+const loginFailedError = "Incorrect email or password"
 
 func handlerReadiness(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Content-Type", "text/plain; charset=utf-8")
@@ -20,6 +28,18 @@ func handlerReadiness(w http.ResponseWriter, r *http.Request) {
 }
 
 // USER HANDLERS
+type userResponse struct {
+	ID          uuid.UUID `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Email       string    `json:"email"`
+	Role        string    `json:"role"`
+	IsChirpyRed bool      `json:"is_chirpy_red"`
+	Badges      []string  `json:"badges"`
+	AvatarURL   *string   `json:"avatar_url"`
+	BannerURL   *string   `json:"banner_url"`
+}
+
 func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request) {
 	type params struct {
 		Email    string `json:"email"`
@@ -34,7 +54,11 @@ func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	hashedPW, err := auth.HashPassword(p.Password)
+	hashedPW, err := cfg.passwords.Hash(p.Password)
+	if errors.Is(err, auth.ErrPasswordTooLong) {
+		respondWithError(w, "Password is too long", http.StatusBadRequest, err)
+		return
+	}
 	if err != nil {
 		respondWithError(w, "There was an error hashing the password", http.StatusInternalServerError, err)
 		return
@@ -52,7 +76,15 @@ func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	respondWithJson(w, 201, user)
+	respondWithJson(w, 201, userResponse{
+		ID:          user.ID,
+		CreatedAt:   user.CreatedAt,
+		UpdatedAt:   user.UpdatedAt,
+		Email:       user.Email,
+		Role:        user.Role,
+		IsChirpyRed: false,
+		Badges:      entitlements.Free.Badges,
+	})
 }
 
 func (cfg *apiConfig) handlerLoginUser(w http.ResponseWriter, r *http.Request) {
@@ -61,62 +93,63 @@ func (cfg *apiConfig) handlerLoginUser(w http.ResponseWriter, r *http.Request) {
 		Password string `json:"password"`
 	}
 
-	type response struct {
-		IsChirpyRed  bool      `json:"is_chirpy_red"`
-		ID           uuid.UUID `json:"id"`
-		Email        string    `json:"email"`
-		Token        string    `json:"token"`
-		RefreshToken string    `json:"refresh_token"`
-	}
-
 	p := params{}
 	decoder := json.NewDecoder(r.Body)
 
 	err := decoder.Decode(&p)
 	if err != nil {
 		respondWithError(w, paramsDecodeError, 400, err)
+		return
 	}
 
-	user, err := cfg.db.GetUserByEmail(r.Context(), p.Email)
+	retryAfter, err := cfg.loginRetryAfter(r, p.Email)
 	if err != nil {
-		respondWithError(w, "No user exists with that email address", 400, err)
+		respondWithError(w, "There was an error checking previous login attempts", http.StatusInternalServerError, err)
+		return
+	}
+	if retryAfter > 0 {
+		respondWithTooManyRequests(w, "Too many failed login attempts, try again later", retryAfter)
+		return
 	}
 
-	err = auth.CheckPasswordHash(p.Password, user.HashedPassword)
+	// Unknown emails and wrong passwords get the same response so the
+	// endpoint can't be used to find out which emails have accounts.
+	user, err := cfg.db.GetUserByEmail(r.Context(), p.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		cfg.passwords.Verify(p.Password, cfg.dummyPasswordHash)
+		cfg.recordLoginAttempt(r, p.Email, uuid.NullUUID{}, false)
+		respondWithError(w, loginFailedError, http.StatusUnauthorized, err)
+		return
+	}
 	if err != nil {
-		respondWithError(w, "Wrong password", 401, err)
+		respondWithError(w, "There was an error getting the user", http.StatusInternalServerError, err)
 		return
 	}
 
-	accessToken, err := auth.MakeJWT(user.ID, cfg.jwtSecret)
+	needsRehash, err := cfg.passwords.Verify(p.Password, user.HashedPassword)
 	if err != nil {
-		respondWithError(w, "Couldn't create JWT", http.StatusInternalServerError, err)
+		cfg.recordLoginAttempt(r, p.Email, uuid.NullUUID{UUID: user.ID, Valid: true}, false)
+		respondWithError(w, loginFailedError, http.StatusUnauthorized, err)
 		return
 	}
 
-	refreshToken, err := auth.MakeRefreshToken()
-	if err != nil {
-		respondWithError(w, "Couldn't create refresh token", http.StatusInternalServerError, err)
+	if needsRehash {
+		cfg.rehashPassword(r.Context(), user.ID, user.HashedPassword, p.Password)
+	}
+
+	// Only checked once the password is known to be right, so the response
+	// doesn't reveal that an account is suspended to anyone else.
+	if rejectDisabledAccount(w, accountStatusFromUser(user)) {
 		return
 	}
 
-	refreshTokenParams := database.CreateRefreshTokenParams{
-		Token:     refreshToken,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
-		ExpiresAt: (time.Now().Add(time.Hour * 1440)),
-		UserID:    user.ID,
+	if user.TotpEnabled {
+		cfg.respondWithMFAChallenge(w, user)
+		return
 	}
-	cfg.db.CreateRefreshToken(r.Context(), refreshTokenParams)
 
-	respondWithJson(w, 200, response{
-		ID:           user.ID,
-		Email:        user.Email,
-		IsChirpyRed:  user.IsChirpyRed,
-		Token:        accessToken,
-		RefreshToken: refreshToken,
-	},
-	)
+	cfg.recordLoginAttempt(r, p.Email, uuid.NullUUID{UUID: user.ID, Valid: true}, true)
+	cfg.respondWithSession(w, r, user)
 }
 
 func (cfg *apiConfig) handlerUpdateUser(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
@@ -133,7 +166,11 @@ func (cfg *apiConfig) handlerUpdateUser(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	hashedPW, err := auth.HashPassword(rp.Password)
+	hashedPW, err := cfg.passwords.Hash(rp.Password)
+	if errors.Is(err, auth.ErrPasswordTooLong) {
+		respondWithError(w, "Password is too long", http.StatusBadRequest, err)
+		return
+	}
 	if err != nil {
 		respondWithError(w, "There was an error hashing the password", http.StatusInternalServerError, err)
 		return
@@ -148,9 +185,100 @@ func (cfg *apiConfig) handlerUpdateUser(w http.ResponseWriter, r *http.Request,
 	user, err := cfg.db.UpdateUser(r.Context(), userParams)
 	if err != nil {
 		respondWithError(w, "There was an error updating the User record", http.StatusInternalServerError, err)
+		return
 	}
 
-	respondWithJson(w, 200, user)
+	isChirpyRed, err := cfg.db.IsUserChirpyRed(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, "There was an error getting the user's subscription", http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJson(w, 200, userResponse{
+		ID:          user.ID,
+		CreatedAt:   user.CreatedAt,
+		UpdatedAt:   user.UpdatedAt,
+		Email:       user.Email,
+		Role:        user.Role,
+		IsChirpyRed: isChirpyRed,
+		Badges:      entitlements.For(isChirpyRed).Badges,
+		AvatarURL:   cfg.storageURL(user.AvatarKey),
+		BannerURL:   cfg.storageURL(user.BannerKey),
+	})
+}
+
+func (cfg *apiConfig) handlerGetUserProfile(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		ID          uuid.UUID `json:"id"`
+		CreatedAt   time.Time `json:"created_at"`
+		IsChirpyRed bool      `json:"is_chirpy_red"`
+		Badges      []string  `json:"badges"`
+		AvatarURL   *string   `json:"avatar_url"`
+		BannerURL   *string   `json:"banner_url"`
+	}
+
+	userId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, "Not a valid ID", http.StatusBadRequest, err)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, "User could not be found", http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, "There was an error getting the user", http.StatusInternalServerError, err)
+		return
+	}
+
+	isChirpyRed, err := cfg.db.IsUserChirpyRed(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, "There was an error getting the user's subscription", http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJson(w, 200, response{
+		ID:          user.ID,
+		CreatedAt:   user.CreatedAt,
+		IsChirpyRed: isChirpyRed,
+		Badges:      entitlements.For(isChirpyRed).Badges,
+		AvatarURL:   cfg.storageURL(user.AvatarKey),
+		BannerURL:   cfg.storageURL(user.BannerKey),
+	})
+}
+
+func (cfg *apiConfig) handlerGetSubscription(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	type response struct {
+		Plan             string    `json:"plan"`
+		Status           string    `json:"status"`
+		CurrentPeriodEnd time.Time `json:"current_period_end"`
+		IsChirpyRed      bool      `json:"is_chirpy_red"`
+	}
+
+	subscription, err := cfg.db.GetSubscriptionByUserID(r.Context(), userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, "User does not have a subscription", http.StatusNotFound, nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, "There was an error getting the subscription", http.StatusInternalServerError, err)
+		return
+	}
+
+	isChirpyRed, err := cfg.db.IsUserChirpyRed(r.Context(), userId)
+	if err != nil {
+		respondWithError(w, "There was an error getting the subscription", http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJson(w, 200, response{
+		Plan:             subscription.Plan,
+		Status:           subscription.Status,
+		CurrentPeriodEnd: subscription.CurrentPeriodEnd,
+		IsChirpyRed:      isChirpyRed,
+	})
 }
 
 // TOKEN HANDLERS
@@ -178,6 +306,10 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if rejectDisabledAccount(w, accountStatusFromUser(user)) {
+		return
+	}
+
 	newToken, err := auth.MakeJWT(user.ID, cfg.jwtSecret)
 	if err != nil {
 		respondWithError(w, "There was an error creating the new JWT", http.StatusInternalServerError, err)
@@ -209,71 +341,343 @@ func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 }
 
 // CHIRP HANDLERS
+type chirpResponse struct {
+	ID           uuid.UUID             `json:"id"`
+	CreatedAt    time.Time             `json:"created_at"`
+	UpdatedAt    time.Time             `json:"updated_at"`
+	Body         string                `json:"body"`
+	UserID       uuid.UUID             `json:"user_id"`
+	Status       string                `json:"status"`
+	PublishAt    *time.Time            `json:"publish_at"`
+	Author       chirpAuthorResponse   `json:"author"`
+	Attachments  []attachmentResponse  `json:"attachments"`
+	LinkPreviews []linkPreviewResponse `json:"link_previews"`
+	Poll         *pollResponse         `json:"poll"`
+}
+
+// chirpDetails holds the parts of a chirp's response that are stored apart
+// from the chirp itself.
+type chirpDetails struct {
+	attachments []database.ChirpAttachment
+	author      chirpAuthorResponse
+	previews    []linkPreviewResponse
+	poll        *pollResponse
+}
+
+type chirpAuthorResponse struct {
+	ID        uuid.UUID `json:"id"`
+	AvatarURL *string   `json:"avatar_url"`
+}
+
+func (cfg *apiConfig) chirpToResponse(c database.Chirp, details chirpDetails) chirpResponse {
+	response := chirpResponse{
+		ID:           c.ID,
+		CreatedAt:    c.CreatedAt,
+		UpdatedAt:    c.UpdatedAt,
+		Body:         c.Body,
+		UserID:       c.UserID,
+		Status:       c.Status,
+		PublishAt:    nullTimePtr(c.PublishAt),
+		Author:       details.author,
+		Attachments:  []attachmentResponse{},
+		LinkPreviews: []linkPreviewResponse{},
+		Poll:         details.poll,
+	}
+	for _, a := range details.attachments {
+		response.Attachments = append(response.Attachments, cfg.attachmentToResponse(a))
+	}
+	response.LinkPreviews = append(response.LinkPreviews, details.previews...)
+	return response
+}
+
+// chirpsToResponse loads the attachments, authors, link previews and polls
+// of all the chirps in one query each. Poll results are shown as the viewer
+// is allowed to see them.
+func (cfg *apiConfig) chirpsToResponse(ctx context.Context, chirps []database.Chirp, viewer uuid.NullUUID) ([]chirpResponse, error) {
+	ids := make([]uuid.UUID, 0, len(chirps))
+	userIds := make([]uuid.UUID, 0, len(chirps))
+	for _, c := range chirps {
+		ids = append(ids, c.ID)
+		userIds = append(userIds, c.UserID)
+	}
+
+	attachments, err := cfg.db.GetAttachmentsByChirpIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	byChirp := map[uuid.UUID][]database.ChirpAttachment{}
+	for _, a := range attachments {
+		byChirp[a.ChirpID] = append(byChirp[a.ChirpID], a)
+	}
+
+	authors, err := cfg.chirpAuthors(ctx, userIds)
+	if err != nil {
+		return nil, err
+	}
+
+	previews, err := cfg.linkPreviewsByChirp(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	polls, err := cfg.pollsByChirp(ctx, ids, viewer)
+	if err != nil {
+		return nil, err
+	}
+
+	response := []chirpResponse{}
+	for _, c := range chirps {
+		response = append(response, cfg.chirpToResponse(c, chirpDetails{
+			attachments: byChirp[c.ID],
+			author:      authors[c.UserID],
+			previews:    previews[c.ID],
+			poll:        polls[c.ID],
+		}))
+	}
+	return response, nil
+}
+
+// chirpAuthors returns the author details shown on chirps for each user.
+func (cfg *apiConfig) chirpAuthors(ctx context.Context, userIds []uuid.UUID) (map[uuid.UUID]chirpAuthorResponse, error) {
+	rows, err := cfg.db.GetUserAvatarKeys(ctx, userIds)
+	if err != nil {
+		return nil, err
+	}
+
+	authors := map[uuid.UUID]chirpAuthorResponse{}
+	for _, row := range rows {
+		authors[row.ID] = chirpAuthorResponse{
+			ID:        row.ID,
+			AvatarURL: cfg.storageURL(row.AvatarKey),
+		}
+	}
+	return authors, nil
+}
+
+func (cfg *apiConfig) respondWithChirp(w http.ResponseWriter, r *http.Request, code int, chirp database.Chirp, viewer uuid.NullUUID) {
+	response, err := cfg.chirpsToResponse(r.Context(), []database.Chirp{chirp}, viewer)
+	if err != nil {
+		respondWithError(w, "There was an error getting the chirp's details", http.StatusInternalServerError, err)
+		return
+	}
+	respondWithJson(w, code, response[0])
+}
+
 func (cfg *apiConfig) handlerCreateChirp(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	req, files, ok := decodeChirpRequest(w, r)
+	if !ok {
+		return
+	}
 
-	type params struct {
-		Body string `json:"body"`
+	// A scheduled chirp's poll opens when the chirp is published.
+	opensAt := time.Now()
+	status := chirpStatusPublished
+	if req.PublishAt != nil {
+		err := checkPublishAt(*req.PublishAt, opensAt)
+		if err != nil {
+			respondWithError(w, err.Error(), http.StatusBadRequest, err)
+			return
+		}
+		opensAt = *req.PublishAt
+		status = chirpStatusScheduled
 	}
-	p := params{}
-	decoder := json.NewDecoder(r.Body)
 
-	err := decoder.Decode(&p)
+	poll, err := parsePoll(req.PollOptions, req.PollClosesAt, opensAt)
 	if err != nil {
-		respondWithError(w, paramsDecodeError, http.StatusInternalServerError, err)
+		respondWithError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	ent, err := cfg.entitlementsFor(r.Context(), userId)
+	if err != nil {
+		respondWithError(w, "There was an error getting the user's entitlements", http.StatusInternalServerError, err)
+		return
+	}
+
+	if !ent.AllowsChirpLength(req.Body) {
+		respondWithError(w, fmt.Sprintf("Chirp is longer than %d characters", ent.MaxChirpLength), http.StatusBadRequest, nil)
+		return
+	}
+
+	if !cfg.takeRateLimit(w, r, chirpRateLimit(ent), "user:"+userId.String()) {
+		return
+	}
+
+	decision, err := cfg.checkChirpForSpam(r.Context(), userId, req.Body, uuid.Nil)
+	if err != nil {
+		// The spam checks failing shouldn't stop anyone posting.
+		log.Printf("There was an error checking a chirp for spam: %s", err)
+		decision = spam.Decision{Verdict: spam.Allow}
+	}
+
+	if decision.Verdict == spam.Reject {
+		respondWithError(w, "Chirp was rejected as spam: "+strings.Join(decision.Reasons, ", "), http.StatusBadRequest, nil)
+		return
+	}
+
+	uploads, storedKeys, err := cfg.storeAttachments(r.Context(), files)
+	if errors.Is(err, errInvalidAttachment) {
+		respondWithError(w, "Images must be JPEG, PNG or GIF files of up to 5 MB: "+err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, "There was an error storing the images", http.StatusInternalServerError, err)
+		return
+	}
+
+	authors, err := cfg.chirpAuthors(r.Context(), []uuid.UUID{userId})
+	if err != nil {
+		cfg.deleteStoredFiles(r.Context(), storedKeys)
+		respondWithError(w, "There was an error getting the chirp's author", http.StatusInternalServerError, err)
 		return
 	}
 
 	createParams := database.CreateChirpParams{
-		Body:   p.Body,
-		UserID: userId,
+		Body:           req.Body,
+		UserID:         userId,
+		ShadowHiddenAt: sql.NullTime{Time: time.Now(), Valid: decision.Verdict == spam.ShadowHide},
+		PublishAt:      sql.NullTime{Time: opensAt, Valid: req.PublishAt != nil},
+		Status:         status,
 	}
 
-	chirp, err := cfg.db.CreateChirp(r.Context(), createParams)
+	chirp, details, err := cfg.createChirp(r.Context(), createParams, uploads, poll)
 	if err != nil {
+		cfg.deleteStoredFiles(r.Context(), storedKeys)
 		respondWithError(w, "There was an error creating the chirp", 400, err)
 		return
 	}
 
-	respondWithJson(w, 201, chirp)
+	if decision.Verdict >= spam.Flag {
+		cfg.reportSpam(r.Context(), chirp, decision)
+	}
+
+	details.author = authors[userId]
+	response := cfg.chirpToResponse(chirp, details)
+
+	// Scheduled chirps are announced by the scheduler when they go out.
+	if chirp.Status == chirpStatusPublished {
+		cfg.afterChirpPublished(r.Context(), chirp, response)
+	}
+
+	respondWithJson(w, 201, response)
 }
 
-func (cfg *apiConfig) handlerGetAllChirps(w http.ResponseWriter, r *http.Request) {
+// createChirp saves a chirp together with its already stored attachments
+// and its poll, returning the details of both.
+func (cfg *apiConfig) createChirp(ctx context.Context, params database.CreateChirpParams, uploads []database.CreateChirpAttachmentParams, poll newPoll) (database.Chirp, chirpDetails, error) {
+	tx, err := cfg.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return database.Chirp{}, chirpDetails{}, err
+	}
+	defer tx.Rollback()
+
+	qtx := cfg.db.WithTx(tx)
+
+	chirp, err := qtx.CreateChirp(ctx, params)
+	if err != nil {
+		return database.Chirp{}, chirpDetails{}, err
+	}
+
+	details := chirpDetails{}
+	for _, upload := range uploads {
+		upload.ChirpID = chirp.ID
+		attachment, err := qtx.CreateChirpAttachment(ctx, upload)
+		if err != nil {
+			return database.Chirp{}, chirpDetails{}, err
+		}
+		details.attachments = append(details.attachments, attachment)
+	}
+
+	details.poll, err = createPoll(ctx, qtx, chirp.ID, poll)
+	if err != nil {
+		return database.Chirp{}, chirpDetails{}, err
+	}
+
+	err = saveChirpLinks(ctx, qtx, chirp)
+	if err != nil {
+		return database.Chirp{}, chirpDetails{}, err
+	}
+
+	return chirp, details, tx.Commit()
+}
+
+// updateChirpBody changes a chirp's text and the links recorded for it, and
+// shadow hides it if the new text needs to be.
+func (cfg *apiConfig) updateChirpBody(ctx context.Context, params database.UpdateChirpBodyParams, shadowHide bool) (database.Chirp, error) {
+	tx, err := cfg.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	defer tx.Rollback()
+
+	qtx := cfg.db.WithTx(tx)
+
+	if shadowHide {
+		err = qtx.ShadowHideChirp(ctx, params.ID)
+		if err != nil {
+			return database.Chirp{}, err
+		}
+	}
+
+	chirp, err := qtx.UpdateChirpBody(ctx, params)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+
+	err = saveChirpLinks(ctx, qtx, chirp)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+
+	return chirp, tx.Commit()
+}
+
+func (cfg *apiConfig) handlerGetAllChirps(w http.ResponseWriter, r *http.Request, viewer uuid.NullUUID) {
 	authorId := r.URL.Query().Get("author_id")
 	sortParam := r.URL.Query().Get("sort")
 
+	var chirps []database.Chirp
 	if authorId != "" {
-		fmt.Println(authorId)
 		parsedId, err := uuid.Parse(authorId)
 		if err != nil {
 			respondWithError(w, "There was an error parsing the ID", http.StatusInternalServerError, err)
 			return
 		}
 
-		chirps, err := cfg.db.GetChirpsByUserID(r.Context(), parsedId)
+		chirps, err = cfg.db.GetChirpsByUserID(r.Context(), parsedId)
 		if err != nil {
 			respondWithError(w, "There was an error getting all the chirps", 400, err)
 			return
 		}
-		if sortParam == "desc" {
-			respondWithJson(w, 200, sortChirpsDesc(chirps))
-			return
-		}
-		respondWithJson(w, 200, chirps)
 	} else {
-		chirps, err := cfg.db.GetChirps(r.Context())
+		var err error
+		chirps, err = cfg.db.GetChirps(r.Context())
 		if err != nil {
 			respondWithError(w, "There was an error getting all the chirps", 400, err)
 			return
 		}
-		if sortParam == "desc" {
-			respondWithJson(w, 200, sortChirpsDesc(chirps))
-			return
-		}
-		respondWithJson(w, 200, chirps)
 	}
+
+	chirps, err := cfg.hideChirpsFromViewer(r, viewer, chirps)
+	if err != nil {
+		respondWithError(w, "There was an error getting blocked and muted users", http.StatusInternalServerError, err)
+		return
+	}
+
+	if sortParam == "desc" {
+		chirps = sortChirpsDesc(chirps)
+	}
+
+	response, err := cfg.chirpsToResponse(r.Context(), chirps, viewer)
+	if err != nil {
+		respondWithError(w, "There was an error getting the chirps' details", http.StatusInternalServerError, err)
+		return
+	}
+	respondWithJson(w, 200, response)
 }
 
-func (cfg *apiConfig) handlerGetOneChirp(w http.ResponseWriter, r *http.Request) {
+func (cfg *apiConfig) handlerGetOneChirp(w http.ResponseWriter, r *http.Request, viewer uuid.NullUUID) {
 
 	pathID := r.PathValue("id")
 	id, err := uuid.Parse(pathID)
@@ -289,7 +693,36 @@ func (cfg *apiConfig) handlerGetOneChirp(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	respondWithJson(w, 200, chirp)
+	visible, err := cfg.chirpVisibleTo(r.Context(), viewer, chirp)
+	if err != nil {
+		respondWithError(w, "There was an error getting the chirp's author", http.StatusInternalServerError, err)
+		return
+	}
+	if !visible {
+		respondWithError(w, "There was an error getting the chirp by ID", 404, nil)
+		return
+	}
+
+	cfg.respondWithChirp(w, r, 200, chirp, viewer)
+}
+
+// chirpVisibleTo reports whether a chirp can be fetched by the viewer.
+// Chirps hidden by a moderator are treated as gone, and shadow hidden and
+// scheduled ones are for everyone but their author. So are chirps by banned
+// users, until the ban is lifted.
+func (cfg *apiConfig) chirpVisibleTo(ctx context.Context, viewer uuid.NullUUID, chirp database.Chirp) (bool, error) {
+	if chirp.HiddenAt.Valid {
+		return false, nil
+	}
+	if (chirp.ShadowHiddenAt.Valid || chirp.Status == chirpStatusScheduled) && !isChirpAuthor(viewer, chirp) {
+		return false, nil
+	}
+
+	author, err := cfg.accountStatusFor(ctx, chirp.UserID)
+	if err != nil {
+		return false, err
+	}
+	return !author.Banned, nil
 }
 
 func handlerValidateChirp(w http.ResponseWriter, r *http.Request) {
@@ -311,7 +744,7 @@ func handlerValidateChirp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if len(p.Body) > 140 {
+	if !entitlements.Free.AllowsChirpLength(p.Body) {
 		respondWithError(w, "Chirp is too long", 400, nil)
 		return
 	}
@@ -321,14 +754,25 @@ func handlerValidateChirp(w http.ResponseWriter, r *http.Request) {
 	respondWithJson(w, 200, validParams{CleanedBody: clean})
 }
 
-func (cfg *apiConfig) handlerDeleteChirp(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
-	pathID := r.PathValue("id")
-	chirpId, err := uuid.Parse(pathID)
+func (cfg *apiConfig) handlerUpdateChirp(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	type params struct {
+		Body string `json:"body"`
+	}
+
+	chirpId, err := uuid.Parse(r.PathValue("id"))
 	if err != nil {
 		respondWithError(w, "Not a valid ID", http.StatusBadRequest, err)
 		return
 	}
 
+	p := params{}
+	decoder := json.NewDecoder(r.Body)
+	err = decoder.Decode(&p)
+	if err != nil {
+		respondWithError(w, paramsDecodeError, http.StatusBadRequest, err)
+		return
+	}
+
 	chirp, err := cfg.db.GetChirpByID(r.Context(), chirpId)
 	if err != nil {
 		respondWithError(w, "Chirp could not be found", 404, err)
@@ -336,65 +780,113 @@ func (cfg *apiConfig) handlerDeleteChirp(w http.ResponseWriter, r *http.Request,
 	}
 
 	if chirp.UserID != userId {
-		respondWithError(w, "User is not authorized to delete this Chirp", 403, nil)
+		respondWithError(w, "User is not authorized to edit this Chirp", 403, nil)
 		return
 	}
 
-	err = cfg.db.DeleteChirp(r.Context(), chirpId)
+	ent, err := cfg.entitlementsFor(r.Context(), userId)
 	if err != nil {
-		respondWithError(w, "The chirp could not be deleted", http.StatusInternalServerError, err)
+		respondWithError(w, "There was an error getting the user's entitlements", http.StatusInternalServerError, err)
+		return
 	}
 
-	w.WriteHeader(204)
+	// Scheduled chirps can be edited until they go out.
+	if chirp.HiddenAt.Valid || (chirp.Status == chirpStatusPublished && !ent.CanEditChirp(chirp.CreatedAt, time.Now())) {
+		respondWithError(w, "This Chirp can no longer be edited", 403, nil)
+		return
+	}
 
-}
+	if !ent.AllowsChirpLength(p.Body) {
+		respondWithError(w, fmt.Sprintf("Chirp is longer than %d characters", ent.MaxChirpLength), http.StatusBadRequest, nil)
+		return
+	}
 
-// WEBHOOK HANDLERS
-func (cfg *apiConfig) handlerPolkaWebhook(w http.ResponseWriter, r *http.Request) {
+	// Edits go through the same checks as new chirps, or posting something
+	// harmless and editing it would get around them.
+	decision, err := cfg.checkChirpForSpam(r.Context(), userId, p.Body, chirpId)
+	if err != nil {
+		log.Printf("There was an error checking a chirp for spam: %s", err)
+		decision = spam.Decision{Verdict: spam.Allow}
+	}
 
-	apiKey, err := auth.GetAPIKey(r.Header)
+	if decision.Verdict == spam.Reject {
+		respondWithError(w, "Chirp was rejected as spam: "+strings.Join(decision.Reasons, ", "), http.StatusBadRequest, nil)
+		return
+	}
+
+	wasAnnounced, err := cfg.shouldAnnounceChirp(r.Context(), chirp)
 	if err != nil {
-		respondWithError(w, "No API key was present", http.StatusUnauthorized, err)
+		respondWithError(w, "There was an error getting the chirp's author", http.StatusInternalServerError, err)
 		return
 	}
 
-	if apiKey != cfg.polkaAPIKey {
-		respondWithError(w, "API key did not match the stored key", http.StatusUnauthorized, err)
+	chirp, err = cfg.updateChirpBody(r.Context(), database.UpdateChirpBodyParams{
+		ID:   chirpId,
+		Body: p.Body,
+	}, decision.Verdict == spam.ShadowHide)
+	if err != nil {
+		respondWithError(w, "The chirp could not be updated", http.StatusInternalServerError, err)
 		return
 	}
 
-	type params struct {
-		Event string `json:"event"`
-		Data  struct {
-			UserID string `json:"user_id"`
-		} `json:"data"`
+	// Everyone else stops seeing a chirp once it is shadow hidden, so
+	// anyone who was sent it is told it has gone.
+	if wasAnnounced && chirp.ShadowHiddenAt.Valid {
+		cfg.afterChirpWithdrawn(r.Context(), chirp)
 	}
 
-	p := params{}
-	decoder := json.NewDecoder(r.Body)
-	err = decoder.Decode(&p)
+	if decision.Verdict >= spam.Flag {
+		cfg.reportSpam(r.Context(), chirp, decision)
+	}
 
+	cfg.respondWithChirp(w, r, 200, chirp, uuid.NullUUID{UUID: userId, Valid: true})
+}
+
+func (cfg *apiConfig) handlerDeleteChirp(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	pathID := r.PathValue("id")
+	chirpId, err := uuid.Parse(pathID)
 	if err != nil {
-		respondWithError(w, paramsDecodeError, http.StatusBadRequest, err)
+		respondWithError(w, "Not a valid ID", http.StatusBadRequest, err)
+		return
+	}
+
+	chirp, err := cfg.db.GetChirpByID(r.Context(), chirpId)
+	if err != nil {
+		respondWithError(w, "Chirp could not be found", 404, err)
 		return
 	}
 
-	if p.Event != "user.upgraded" {
-		respondWithJson(w, http.StatusNoContent, nil)
+	if chirp.UserID != userId {
+		respondWithError(w, "User is not authorized to delete this Chirp", 403, nil)
 		return
 	}
 
-	id, err := uuid.Parse(p.Data.UserID)
+	attachments, err := cfg.db.GetAttachmentsByChirpIDs(r.Context(), []uuid.UUID{chirpId})
 	if err != nil {
-		respondWithError(w, "There was an issue parsing the user ID", http.StatusInternalServerError, err)
+		respondWithError(w, "There was an error getting the chirp's attachments and author", http.StatusInternalServerError, err)
 		return
 	}
 
-	_, err = cfg.db.UpgradeUser(r.Context(), id)
+	wasAnnounced, err := cfg.shouldAnnounceChirp(r.Context(), chirp)
 	if err != nil {
-		respondWithError(w, "There was an issue updating the user record", http.StatusInternalServerError, err)
+		respondWithError(w, "There was an error getting the chirp's author", http.StatusInternalServerError, err)
 		return
 	}
 
-	respondWithJson(w, 204, nil)
+	err = cfg.db.DeleteChirp(r.Context(), chirpId)
+	if err != nil {
+		respondWithError(w, "The chirp could not be deleted", http.StatusInternalServerError, err)
+		return
+	}
+
+	cfg.deleteStoredFiles(r.Context(), attachmentKeys(attachments))
+
+	// Chirps nobody else was told about go quietly, or the deletion would
+	// give them away.
+	if wasAnnounced {
+		cfg.afterChirpWithdrawn(r.Context(), chirp)
+	}
+
+	w.WriteHeader(204)
+
 }
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sam-maton/chirpy/internal/database"
+	"github.com/sam-maton/chirpy/internal/imaging"
+)
+
+const (
+	maxAttachments     = 4
+	maxAttachmentBytes = 5 << 20
+	// maxChirpRequestBytes leaves room for the chirp body and the multipart
+	// framing on top of the images themselves.
+	maxChirpRequestBytes = maxAttachments*maxAttachmentBytes + 1<<20
+	// Uploads bigger than this are buffered to temporary files while the
+	// form is parsed.
+	multipartMemoryBytes = 8 << 20
+	thumbnailSize        = 400
+)
+
+var errInvalidAttachment = errors.New("invalid attachment")
+
+type attachmentResponse struct {
+	ID           uuid.UUID `json:"id"`
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnail_url"`
+	ContentType  string    `json:"content_type"`
+	Width        int32     `json:"width"`
+	Height       int32     `json:"height"`
+	SizeBytes    int32     `json:"size_bytes"`
+}
+
+func (cfg *apiConfig) attachmentToResponse(a database.ChirpAttachment) attachmentResponse {
+	return attachmentResponse{
+		ID:           a.ID,
+		URL:          cfg.storage.URL(a.StorageKey),
+		ThumbnailURL: cfg.storage.URL(a.ThumbnailKey),
+		ContentType:  a.ContentType,
+		Width:        a.Width,
+		Height:       a.Height,
+		SizeBytes:    a.SizeBytes,
+	}
+}
+
+type chirpRequest struct {
+	Body         string     `json:"body"`
+	PollOptions  []string   `json:"poll_options"`
+	PollClosesAt *time.Time `json:"poll_closes_at"`
+	PublishAt    *time.Time `json:"publish_at"`
+}
+
+// decodeChirpRequest reads a new chirp from either a JSON body or a
+// multipart form with the same fields, where "poll_options" is repeated
+// for each option and times are RFC 3339, plus up to four "images" files.
+func decodeChirpRequest(w http.ResponseWriter, r *http.Request) (chirpRequest, []*multipart.FileHeader, bool) {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		p := chirpRequest{}
+		err := json.NewDecoder(r.Body).Decode(&p)
+		if err != nil {
+			respondWithError(w, paramsDecodeError, http.StatusInternalServerError, err)
+			return chirpRequest{}, nil, false
+		}
+		return p, nil, true
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxChirpRequestBytes)
+	err := r.ParseMultipartForm(multipartMemoryBytes)
+	if err != nil {
+		respondWithError(w, "There was an error reading the upload", http.StatusBadRequest, err)
+		return chirpRequest{}, nil, false
+	}
+
+	p := chirpRequest{
+		Body:        r.FormValue("body"),
+		PollOptions: r.MultipartForm.Value["poll_options"],
+	}
+	p.PollClosesAt, err = formTime(r, "poll_closes_at")
+	if err != nil {
+		respondWithError(w, "poll_closes_at must be an RFC 3339 time", http.StatusBadRequest, err)
+		return chirpRequest{}, nil, false
+	}
+	p.PublishAt, err = formTime(r, "publish_at")
+	if err != nil {
+		respondWithError(w, "publish_at must be an RFC 3339 time", http.StatusBadRequest, err)
+		return chirpRequest{}, nil, false
+	}
+
+	files := r.MultipartForm.File["images"]
+	if len(files) > maxAttachments {
+		respondWithError(w, fmt.Sprintf("A chirp can have at most %d images", maxAttachments), http.StatusBadRequest, nil)
+		return chirpRequest{}, nil, false
+	}
+
+	return p, files, true
+}
+
+// formTime parses an optional RFC 3339 form field.
+func formTime(r *http.Request, name string) (*time.Time, error) {
+	value := r.FormValue(name)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// storeAttachments checks each uploaded image, makes its thumbnail and
+// saves both to storage, returning the attachments and every key stored.
+// Nothing is left in storage if any of them fails. Problems with the images
+// themselves are wrapped in errInvalidAttachment.
+func (cfg *apiConfig) storeAttachments(ctx context.Context, files []*multipart.FileHeader) ([]database.CreateChirpAttachmentParams, []string, error) {
+	stored := []database.CreateChirpAttachmentParams{}
+	keys := []string{}
+
+	for i, file := range files {
+		attachment, err := cfg.storeAttachment(ctx, file)
+		if err != nil {
+			cfg.deleteStoredFiles(ctx, keys)
+			return nil, nil, fmt.Errorf("image %d: %w", i+1, err)
+		}
+		keys = append(keys, attachment.StorageKey, attachment.ThumbnailKey)
+
+		attachment.Position = int32(i)
+		stored = append(stored, attachment)
+	}
+
+	return stored, keys, nil
+}
+
+func (cfg *apiConfig) storeAttachment(ctx context.Context, file *multipart.FileHeader) (database.CreateChirpAttachmentParams, error) {
+	if file.Size > maxAttachmentBytes {
+		return database.CreateChirpAttachmentParams{}, fmt.Errorf("%w: larger than %d MB", errInvalidAttachment, maxAttachmentBytes>>20)
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		return database.CreateChirpAttachmentParams{}, err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxAttachmentBytes+1))
+	if err != nil {
+		return database.CreateChirpAttachmentParams{}, err
+	}
+	if len(data) > maxAttachmentBytes {
+		return database.CreateChirpAttachmentParams{}, fmt.Errorf("%w: larger than %d MB", errInvalidAttachment, maxAttachmentBytes>>20)
+	}
+
+	info, err := imaging.Inspect(data)
+	if err != nil {
+		return database.CreateChirpAttachmentParams{}, fmt.Errorf("%w: %w", errInvalidAttachment, err)
+	}
+
+	thumbnail, err := imaging.Thumbnail(data, info, thumbnailSize)
+	if err != nil {
+		return database.CreateChirpAttachmentParams{}, fmt.Errorf("%w: %w", errInvalidAttachment, err)
+	}
+
+	id := uuid.New()
+	attachment := database.CreateChirpAttachmentParams{
+		ID:           id,
+		ContentType:  info.ContentType,
+		SizeBytes:    int32(len(data)),
+		Width:        int32(info.Width),
+		Height:       int32(info.Height),
+		StorageKey:   "attachments/" + id.String() + imaging.Extensions[info.ContentType],
+		ThumbnailKey: "attachments/" + id.String() + "_thumb.jpg",
+	}
+
+	err = cfg.storage.Put(ctx, attachment.StorageKey, data, info.ContentType)
+	if err != nil {
+		return database.CreateChirpAttachmentParams{}, err
+	}
+
+	err = cfg.storage.Put(ctx, attachment.ThumbnailKey, thumbnail, "image/jpeg")
+	if err != nil {
+		cfg.deleteStoredFiles(ctx, []string{attachment.StorageKey})
+		return database.CreateChirpAttachmentParams{}, err
+	}
+
+	return attachment, nil
+}
+
+// deleteStoredFiles removes files from storage. Failures are only logged,
+// since the worst outcome is an orphaned file.
+func (cfg *apiConfig) deleteStoredFiles(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		err := cfg.storage.Delete(ctx, key)
+		if err != nil {
+			log.Printf("There was an error deleting %s from storage: %s", key, err)
+		}
+	}
+}
+
+// attachmentKeys returns the storage keys of every file belonging to the
+// attachments.
+func attachmentKeys(attachments []database.ChirpAttachment) []string {
+	keys := []string{}
+	for _, a := range attachments {
+		keys = append(keys, a.StorageKey, a.ThumbnailKey)
+	}
+	return keys
+}
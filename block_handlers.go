@@ -0,0 +1,197 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sam-maton/chirpy/internal/database"
+)
+
+type relationResponse struct {
+	UserID    uuid.UUID `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BLOCK AND MUTE HANDLERS
+func (cfg *apiConfig) handlerBlockUser(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	targetId, ok := cfg.targetUserFromPath(w, r, userId)
+	if !ok {
+		return
+	}
+
+	err := cfg.db.BlockUser(r.Context(), database.BlockUserParams{
+		BlockerID: userId,
+		BlockedID: targetId,
+	})
+	if err != nil {
+		respondWithError(w, "There was an error blocking the user", http.StatusInternalServerError, err)
+		return
+	}
+
+	// Both users stop seeing each other's chirps as they happen.
+	cfg.publishUserUpdated(r.Context(), userId)
+	cfg.publishUserUpdated(r.Context(), targetId)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerUnblockUser(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	targetId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, "Not a valid ID", http.StatusBadRequest, err)
+		return
+	}
+
+	removed, err := cfg.db.UnblockUser(r.Context(), database.UnblockUserParams{
+		BlockerID: userId,
+		BlockedID: targetId,
+	})
+	if err != nil {
+		respondWithError(w, "There was an error unblocking the user", http.StatusInternalServerError, err)
+		return
+	}
+
+	if removed == 0 {
+		respondWithError(w, "User is not blocked", http.StatusNotFound, nil)
+		return
+	}
+
+	cfg.publishUserUpdated(r.Context(), userId)
+	cfg.publishUserUpdated(r.Context(), targetId)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerGetBlockedUsers(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	blocked, err := cfg.db.GetBlockedUsers(r.Context(), userId)
+	if err != nil {
+		respondWithError(w, "There was an error getting blocked users", http.StatusInternalServerError, err)
+		return
+	}
+
+	response := []relationResponse{}
+	for _, b := range blocked {
+		response = append(response, relationResponse{UserID: b.BlockedID, CreatedAt: b.CreatedAt})
+	}
+
+	respondWithJson(w, 200, response)
+}
+
+func (cfg *apiConfig) handlerMuteUser(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	targetId, ok := cfg.targetUserFromPath(w, r, userId)
+	if !ok {
+		return
+	}
+
+	err := cfg.db.MuteUser(r.Context(), database.MuteUserParams{
+		MuterID: userId,
+		MutedID: targetId,
+	})
+	if err != nil {
+		respondWithError(w, "There was an error muting the user", http.StatusInternalServerError, err)
+		return
+	}
+
+	cfg.publishUserUpdated(r.Context(), userId)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerUnmuteUser(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	targetId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, "Not a valid ID", http.StatusBadRequest, err)
+		return
+	}
+
+	removed, err := cfg.db.UnmuteUser(r.Context(), database.UnmuteUserParams{
+		MuterID: userId,
+		MutedID: targetId,
+	})
+	if err != nil {
+		respondWithError(w, "There was an error unmuting the user", http.StatusInternalServerError, err)
+		return
+	}
+
+	if removed == 0 {
+		respondWithError(w, "User is not muted", http.StatusNotFound, nil)
+		return
+	}
+
+	cfg.publishUserUpdated(r.Context(), userId)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerGetMutedUsers(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	muted, err := cfg.db.GetMutedUsers(r.Context(), userId)
+	if err != nil {
+		respondWithError(w, "There was an error getting muted users", http.StatusInternalServerError, err)
+		return
+	}
+
+	response := []relationResponse{}
+	for _, m := range muted {
+		response = append(response, relationResponse{UserID: m.MutedID, CreatedAt: m.CreatedAt})
+	}
+
+	respondWithJson(w, 200, response)
+}
+
+// targetUserFromPath returns the user in the {id} path value, checking that
+// they exist and aren't the caller. It writes the error response itself and
+// returns false if anything is wrong.
+func (cfg *apiConfig) targetUserFromPath(w http.ResponseWriter, r *http.Request, userId uuid.UUID) (uuid.UUID, bool) {
+	targetId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, "Not a valid ID", http.StatusBadRequest, err)
+		return uuid.Nil, false
+	}
+
+	if targetId == userId {
+		respondWithError(w, "You can't do this to yourself", http.StatusBadRequest, nil)
+		return uuid.Nil, false
+	}
+
+	_, err = cfg.db.GetUserByID(r.Context(), targetId)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, "User could not be found", http.StatusNotFound, err)
+		return uuid.Nil, false
+	}
+	if err != nil {
+		respondWithError(w, "There was an error getting the user", http.StatusInternalServerError, err)
+		return uuid.Nil, false
+	}
+
+	return targetId, true
+}
+
+// hideChirpsFromViewer removes chirps by authors the viewer has blocked or
+// muted, or who have blocked the viewer, and shadow hidden chirps by anyone
+// but the viewer.
+func (cfg *apiConfig) hideChirpsFromViewer(r *http.Request, viewer uuid.NullUUID, chirps []database.Chirp) ([]database.Chirp, error) {
+	chirps = slices.DeleteFunc(chirps, func(c database.Chirp) bool {
+		return c.ShadowHiddenAt.Valid && !isChirpAuthor(viewer, c)
+	})
+
+	if !viewer.Valid {
+		return chirps, nil
+	}
+
+	hidden, err := cfg.db.GetHiddenAuthorIDs(r.Context(), viewer.UUID)
+	if err != nil || len(hidden) == 0 {
+		return chirps, err
+	}
+
+	return slices.DeleteFunc(chirps, func(c database.Chirp) bool {
+		return slices.Contains(hidden, c.UserID)
+	}), nil
+}
+
+func isChirpAuthor(viewer uuid.NullUUID, chirp database.Chirp) bool {
+	return viewer.Valid && viewer.UUID == chirp.UserID
+}
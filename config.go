@@ -3,25 +3,79 @@ package main
 import (
 	"database/sql"
 	"log"
+	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"sync/atomic"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/joho/godotenv"
+	"github.com/sam-maton/chirpy/internal/auth"
+	"github.com/sam-maton/chirpy/internal/cache"
 	"github.com/sam-maton/chirpy/internal/database"
+	"github.com/sam-maton/chirpy/internal/entitlements"
+	"github.com/sam-maton/chirpy/internal/oidc"
+	"github.com/sam-maton/chirpy/internal/pubsub"
+	"github.com/sam-maton/chirpy/internal/ratelimit"
+	"github.com/sam-maton/chirpy/internal/realtime"
+	"github.com/sam-maton/chirpy/internal/spam"
+	"github.com/sam-maton/chirpy/internal/storage"
+	"github.com/sam-maton/chirpy/internal/unfurl"
+	"github.com/sam-maton/chirpy/internal/webhooks"
 )
 
 type apiConfig struct {
 	fileServerHits atomic.Int32
 	db             *database.Queries
+	dbConn         *sql.DB
+	dbURL          string
 	jwtSecret      string
-	polkaAPIKey    string
+	polkaKeys      []string
+	platform       string
+	// trustedProxies is how many reverse proxies sit in front of the server.
+	trustedProxies int
+	passwords      auth.PasswordHashers
+
+	accountLoginThrottle auth.LoginThrottle
+	ipLoginThrottle      auth.LoginThrottle
+	// Unknown emails are checked against this hash so they take as long as
+	// a wrong password does.
+	dummyPasswordHash string
+
+	// oidcProvider is nil when OIDC login isn't configured.
+	oidcProvider     *oidc.Provider
+	oidcProviderName string
+
+	webhookSender *webhooks.Sender
+	linkFetcher   *unfurl.Fetcher
+	broker        *pubsub.Broker
+	realtime      *realtime.Server
+
+	entitlementsCache  *cache.Cache[uuid.UUID, entitlements.Entitlements]
+	accountStatusCache *cache.Cache[uuid.UUID, accountStatus]
+
+	rateLimits ratelimit.Store
+	// More classifiers can be added to spam.Classifiers, such as one that
+	// calls out to an external service.
+	spam *spam.Pipeline
+
+	storage storage.Storage
+	// mediaHandler serves stored files when they are kept on local disk. It
+	// is nil when another service serves them.
+	mediaHandler http.Handler
 }
 
 func setupConfig() apiConfig {
 	godotenv.Load()
 	dbURL := os.Getenv("DB_URL")
 	secret := os.Getenv("SECRET")
-	polkaKey := os.Getenv("POLKA_KEY")
+	// POLKA_KEY can hold several comma separated keys while a key is being
+	// rotated.
+	polkaKeys := splitList(os.Getenv("POLKA_KEY"))
+	platform := os.Getenv("PLATFORM")
+	trustedProxies := trustedProxiesFromEnv()
 
 	if dbURL == "" {
 		log.Fatal("DB_URL environment variable must be set")
@@ -31,7 +85,7 @@ func setupConfig() apiConfig {
 		log.Fatal("SECRET environment variable must be set")
 	}
 
-	if polkaKey == "" {
+	if len(polkaKeys) == 0 {
 		log.Fatal("POLKA_KEY environment variable must be set")
 	}
 
@@ -44,10 +98,196 @@ func setupConfig() apiConfig {
 
 	dbQueries := database.New(db)
 
+	passwords := auth.PasswordHashers{
+		Current: auth.Argon2idHasher{Params: argon2idParamsFromEnv()},
+		// Passwords set before the switch to argon2id are rehashed the next
+		// time their owner logs in.
+		Legacy: []auth.PasswordHasher{auth.BcryptHasher{Cost: 10}},
+	}
+
+	dummyHash, err := passwords.Hash("chirpy-dummy-password")
+	if err != nil {
+		log.Fatalf("There was an error creating the dummy password hash: %s", err)
+	}
+
+	var oidcProvider *oidc.Provider
+	oidcIssuer := os.Getenv("OIDC_ISSUER")
+	if oidcIssuer != "" {
+		oidcProvider = oidc.NewProvider(oidc.Config{
+			Issuer:       oidcIssuer,
+			ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+			RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		}, &http.Client{Timeout: 10 * time.Second})
+	}
+
+	oidcProviderName := os.Getenv("OIDC_PROVIDER_NAME")
+	if oidcProviderName == "" {
+		oidcProviderName = "oidc"
+	}
+
+	broker := pubsub.NewBroker(eventHistorySize)
+	realtimeServer := realtime.NewServer(broker, maxSocketsPerUser)
+	realtimeServer.HiddenAuthors = dbQueries.GetHiddenAuthorIDs
+
+	fileStorage, mediaHandler := setupStorage()
+
+	// Buckets are kept in memory unless RATE_LIMIT_STORE=postgres, which is
+	// needed when running more than one server.
+	var rateLimits ratelimit.Store
+	switch os.Getenv("RATE_LIMIT_STORE") {
+	case "", "memory":
+		rateLimits = ratelimit.NewMemoryStore()
+	case "postgres":
+		rateLimits = pgRateLimitStore{db: dbQueries}
+	default:
+		log.Fatal("RATE_LIMIT_STORE must be memory or postgres")
+	}
+
 	return apiConfig{
 		fileServerHits: atomic.Int32{},
 		db:             dbQueries,
+		dbConn:         db,
+		dbURL:          dbURL,
 		jwtSecret:      secret,
-		polkaAPIKey:    polkaKey,
+		polkaKeys:      polkaKeys,
+		platform:       platform,
+		trustedProxies: trustedProxies,
+		passwords:      passwords,
+		accountLoginThrottle: auth.LoginThrottle{
+			Window:          time.Hour,
+			FreeAttempts:    3,
+			BaseDelay:       time.Second,
+			MaxDelay:        time.Minute,
+			LockoutAttempts: 10,
+			LockoutDuration: 15 * time.Minute,
+		},
+		ipLoginThrottle: auth.LoginThrottle{
+			Window:          time.Hour,
+			FreeAttempts:    20,
+			BaseDelay:       time.Second,
+			MaxDelay:        time.Minute,
+			LockoutAttempts: 100,
+			LockoutDuration: time.Hour,
+		},
+		dummyPasswordHash:  dummyHash,
+		oidcProvider:       oidcProvider,
+		oidcProviderName:   oidcProviderName,
+		webhookSender:      webhooks.NewSender(10 * time.Second),
+		linkFetcher:        unfurl.NewFetcher(5 * time.Second),
+		broker:             broker,
+		realtime:           realtimeServer,
+		entitlementsCache:  cache.New[uuid.UUID, entitlements.Entitlements](entitlementsCacheTTL),
+		accountStatusCache: cache.New[uuid.UUID, accountStatus](accountStatusCacheTTL),
+		rateLimits:         rateLimits,
+		spam:               spam.DefaultPipeline(),
+		storage:            fileStorage,
+		mediaHandler:       mediaHandler,
+	}
+}
+
+// setupStorage picks where uploaded files go from STORAGE_BACKEND. Local
+// storage is served by the API itself under /media/.
+func setupStorage() (storage.Storage, http.Handler) {
+	switch os.Getenv("STORAGE_BACKEND") {
+	case "", "local":
+		dir := os.Getenv("MEDIA_DIR")
+		if dir == "" {
+			dir = "./media"
+		}
+
+		local, err := storage.NewLocal(dir, "/media")
+		if err != nil {
+			log.Fatalf("There was an error creating the media directory: %s", err)
+		}
+		return local, local.Handler()
+	case "s3":
+		bucket := os.Getenv("S3_BUCKET")
+		if bucket == "" {
+			log.Fatal("S3_BUCKET environment variable must be set when STORAGE_BACKEND=s3")
+		}
+
+		region := os.Getenv("S3_REGION")
+		if region == "" {
+			region = "us-east-1"
+		}
+
+		endpoint := os.Getenv("S3_ENDPOINT")
+		if endpoint == "" {
+			endpoint = "https://s3." + region + ".amazonaws.com"
+		}
+
+		return storage.NewS3(
+			endpoint,
+			bucket,
+			region,
+			os.Getenv("S3_ACCESS_KEY_ID"),
+			os.Getenv("S3_SECRET_ACCESS_KEY"),
+			os.Getenv("S3_PUBLIC_URL"),
+		), nil
+	default:
+		log.Fatal("STORAGE_BACKEND must be local or s3")
+	}
+	return nil, nil
+}
+
+func argon2idParamsFromEnv() auth.Argon2idParams {
+	params := auth.DefaultArgon2idParams
+
+	if memory := os.Getenv("ARGON2_MEMORY_KIB"); memory != "" {
+		m, err := strconv.ParseUint(memory, 10, 32)
+		if err != nil {
+			log.Fatalf("ARGON2_MEMORY_KIB must be a number: %s", err)
+		}
+		params.Memory = uint32(m)
+	}
+
+	if iterations := os.Getenv("ARGON2_ITERATIONS"); iterations != "" {
+		t, err := strconv.ParseUint(iterations, 10, 32)
+		if err != nil {
+			log.Fatalf("ARGON2_ITERATIONS must be a number: %s", err)
+		}
+		params.Iterations = uint32(t)
+	}
+
+	if parallelism := os.Getenv("ARGON2_PARALLELISM"); parallelism != "" {
+		p, err := strconv.ParseUint(parallelism, 10, 8)
+		if err != nil {
+			log.Fatalf("ARGON2_PARALLELISM must be a number: %s", err)
+		}
+		params.Parallelism = uint8(p)
+	}
+
+	return params
+}
+
+// trustedProxiesFromEnv reads TRUST_PROXY, which is the number of reverse
+// proxies in front of the server. "true" means a single proxy, for
+// compatibility with when it was a flag.
+func trustedProxiesFromEnv() int {
+	switch trust := os.Getenv("TRUST_PROXY"); trust {
+	case "", "false":
+		return 0
+	case "true":
+		return 1
+	default:
+		n, err := strconv.Atoi(trust)
+		if err != nil || n < 0 {
+			log.Fatalf("TRUST_PROXY must be true, false or a number of proxies: %q", trust)
+		}
+		return n
+	}
+}
+
+// splitList splits a comma separated environment variable, dropping spaces
+// around entries and any empty ones.
+func splitList(value string) []string {
+	list := []string{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry != "" {
+			list = append(list, entry)
+		}
 	}
+	return list
 }
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sam-maton/chirpy/internal/entitlements"
+)
+
+// entitlementsCacheTTL is only a backstop. Subscription changes also clear
+// the user's entry on every server through a user.updated event.
+const entitlementsCacheTTL = 5 * time.Minute
+
+// entitlementsFor looks up what the user is allowed to do. Handlers should
+// check the returned Entitlements rather than Chirpy Red status directly.
+func (cfg *apiConfig) entitlementsFor(ctx context.Context, userId uuid.UUID) (entitlements.Entitlements, error) {
+	if ent, ok := cfg.entitlementsCache.Get(userId); ok {
+		return ent, nil
+	}
+
+	isChirpyRed, err := cfg.db.IsUserChirpyRed(ctx, userId)
+	if err != nil {
+		return entitlements.Entitlements{}, err
+	}
+
+	ent := entitlements.For(isChirpyRed)
+	cfg.entitlementsCache.Set(userId, ent)
+	return ent, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/sam-maton/chirpy/internal/pubsub"
+)
+
+const (
+	eventsChannel = "chirpy_events"
+	// NOTIFY payloads must be shorter than 8000 bytes.
+	maxNotifyPayloadBytes = 7900
+
+	listenerPingInterval = time.Minute
+	// eventPayloadRetention is how long an event's data is kept for servers
+	// that are slow to handle it.
+	eventPayloadRetention = 10 * time.Minute
+)
+
+// runEventListener relays events published by any server to this server's
+// subscribers until ctx is cancelled.
+func (cfg *apiConfig) runEventListener(ctx context.Context) {
+	listener := pq.NewListener(cfg.dbURL, 10*time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Event listener connection problem: %s", err)
+		}
+	})
+	defer listener.Close()
+
+	err := listener.Listen(eventsChannel)
+	if err != nil {
+		log.Printf("There was an error listening for events: %s", err)
+		return
+	}
+
+	ping := time.NewTicker(listenerPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n := <-listener.Notify:
+			// A nil notification means the connection was re-established and
+			// events may have been missed, so nothing cached can be trusted.
+			if n == nil {
+				cfg.entitlementsCache.Clear()
+				cfg.accountStatusCache.Clear()
+				continue
+			}
+
+			event := pubsub.Event{}
+			err := json.Unmarshal([]byte(n.Extra), &event)
+			if err != nil {
+				log.Printf("There was an error decoding an event: %s", err)
+				continue
+			}
+
+			event.Data, err = cfg.db.GetEventPayload(ctx, int64(event.ID))
+			if err != nil {
+				log.Printf("There was an error loading event %d: %s", event.ID, err)
+				continue
+			}
+			cfg.handleEvent(event)
+		case <-ping.C:
+			// Pinging notices a dead connection sooner than waiting for the
+			// next notification would.
+			go listener.Ping()
+
+			err := cfg.db.DeleteEventPayloadsBefore(ctx, time.Now().Add(-eventPayloadRetention))
+			if err != nil {
+				log.Printf("There was an error deleting old event payloads: %s", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sam-maton/chirpy/internal/database"
+	"github.com/sam-maton/chirpy/internal/pubsub"
+	"github.com/sam-maton/chirpy/internal/realtime"
+)
+
+// Real-time event types, sent to stream and socket clients.
+const (
+	eventChirpCreated        = "chirp.created"
+	eventChirpDeleted        = "chirp.deleted"
+	eventSubscriptionUpdated = "subscription.updated"
+
+	// eventUserUpdated has no topics. It only tells every server to drop
+	// anything it has cached about the user, including who they have
+	// blocked or muted.
+	eventUserUpdated = "user.updated"
+)
+
+const (
+	topicTimeline = realtime.TopicTimeline
+
+	// eventHistorySize is how many events a reconnecting client can catch up
+	// on.
+	eventHistorySize = 1000
+)
+
+var hashtagPattern = regexp.MustCompile(`#([A-Za-z0-9_]{1,50})`)
+
+func userTopic(userId uuid.UUID) string {
+	return realtime.TopicUserPrefix + userId.String()
+}
+
+func notificationsTopic(userId uuid.UUID) string {
+	return realtime.TopicNotificationsPrefix + userId.String()
+}
+
+// chirpTopics returns the topics a chirp's events go to: the timeline, its
+// author and each hashtag in its body.
+func chirpTopics(chirp database.Chirp) []string {
+	topics := []string{topicTimeline, userTopic(chirp.UserID)}
+	for _, match := range hashtagPattern.FindAllStringSubmatch(chirp.Body, -1) {
+		topic := realtime.TopicTagPrefix + strings.ToLower(match[1])
+		if !slices.Contains(topics, topic) {
+			topics = append(topics, topic)
+		}
+	}
+	return topics
+}
+
+func (cfg *apiConfig) publishChirpCreated(ctx context.Context, chirp database.Chirp, response chirpResponse) {
+	cfg.publishEvent(ctx, eventChirpCreated, chirpTopics(chirp), response)
+}
+
+// publishNotification sends an event only to the user's own connections.
+func (cfg *apiConfig) publishNotification(ctx context.Context, userId uuid.UUID, eventType string, data any) {
+	cfg.publishEvent(ctx, eventType, []string{notificationsTopic(userId)}, data)
+}
+
+func (cfg *apiConfig) publishUserUpdated(ctx context.Context, userId uuid.UUID) {
+	cfg.publishEvent(ctx, eventUserUpdated, nil, userEventData{UserID: userId})
+}
+
+type userEventData struct {
+	UserID uuid.UUID `json:"user_id"`
+}
+
+func (cfg *apiConfig) publishChirpDeleted(ctx context.Context, chirp database.Chirp) {
+	cfg.publishEvent(ctx, eventChirpDeleted, chirpTopics(chirp), struct {
+		ID     uuid.UUID `json:"id"`
+		UserID uuid.UUID `json:"user_id"`
+	}{
+		ID:     chirp.ID,
+		UserID: chirp.UserID,
+	})
+}
+
+// publishEvent sends an event to every server through Postgres NOTIFY,
+// including this one, which picks it up in runEventListener. If that fails
+// the event is still delivered to this server's own subscribers.
+func (cfg *apiConfig) publishEvent(ctx context.Context, eventType string, topics []string, data any) {
+	dat, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("There was an error encoding the %s event: %s", eventType, err)
+		return
+	}
+
+	event := pubsub.Event{
+		Type:   eventType,
+		Topics: topics,
+		Data:   dat,
+	}
+
+	err = cfg.notifyEvent(ctx, &event)
+	if err != nil {
+		log.Printf("There was an error sending the %s event to other servers: %s", eventType, err)
+		cfg.handleEvent(event)
+	}
+}
+
+// notifyEvent stores the event's data and sends the rest of it to every
+// server, so how big the data is doesn't matter to NOTIFY.
+func (cfg *apiConfig) notifyEvent(ctx context.Context, event *pubsub.Event) error {
+	id, err := cfg.db.CreateEventPayload(ctx, event.Data)
+	if err != nil {
+		return err
+	}
+	event.ID = uint64(id)
+
+	payload, err := json.Marshal(pubsub.Event{
+		ID:     event.ID,
+		Type:   event.Type,
+		Topics: event.Topics,
+	})
+	if err != nil {
+		return err
+	}
+	if len(payload) > maxNotifyPayloadBytes {
+		return errors.New("event is too large for NOTIFY")
+	}
+
+	return cfg.db.NotifyEvent(ctx, database.NotifyEventParams{
+		Channel: eventsChannel,
+		Payload: string(payload),
+	})
+}
+
+// handleEvent applies an event on this server, whichever server it was
+// published on.
+func (cfg *apiConfig) handleEvent(event pubsub.Event) {
+	if event.Type == eventUserUpdated {
+		data := userEventData{}
+		err := json.Unmarshal(event.Data, &data)
+		if err != nil {
+			log.Printf("There was an error decoding a %s event: %s", event.Type, err)
+			return
+		}
+		cfg.entitlementsCache.Delete(data.UserID)
+		cfg.accountStatusCache.Delete(data.UserID)
+		go cfg.refreshHiddenAuthors(data.UserID)
+		go cfg.disconnectIfDisabled(data.UserID)
+	}
+
+	if len(event.Topics) > 0 {
+		cfg.broker.Publish(event)
+	}
+}
+
+// refreshHiddenAuthors reloads who the user has blocked or muted, or been
+// blocked by, for their WebSocket connections on this server.
+func (cfg *apiConfig) refreshHiddenAuthors(userId uuid.UUID) {
+	err := cfg.realtime.RefreshHidden(context.Background(), userId)
+	if err != nil {
+		log.Printf("There was an error refreshing hidden authors for %s: %s", userId, err)
+	}
+}
+
+// disconnectIfDisabled closes the user's WebSocket connections on this server
+// once their account is suspended, banned or deleted, rather than leaving
+// them open until the token expires.
+func (cfg *apiConfig) disconnectIfDisabled(userId uuid.UUID) {
+	status, err := cfg.accountStatusFor(context.Background(), userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		cfg.realtime.Disconnect(userId, "account no longer exists")
+		return
+	}
+	if err != nil {
+		log.Printf("There was an error checking the account status of %s: %s", userId, err)
+		return
+	}
+
+	// Close reasons have to be short, so the suspension reason is left out.
+	if status.Banned {
+		cfg.realtime.Disconnect(userId, "account banned")
+	} else if status.disabled(time.Now()) {
+		cfg.realtime.Disconnect(userId, "account suspended")
+	}
+}
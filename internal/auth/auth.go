@@ -10,28 +10,69 @@ import (
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
 var ErrNoAuthHeaderIncluded = errors.New("no auth header included in request")
 
-func HashPassword(password string) (string, error) {
-	p, err := bcrypt.GenerateFromPassword([]byte(password), 10)
+const (
+	accessTokenIssuer = "chirpy"
+	mfaTokenIssuer    = "chirpy-mfa"
+)
 
-	return string(p), err
+func MakeJWT(userID uuid.UUID, tokenSecret string) (string, error) {
+	return makeJWT(userID, tokenSecret, accessTokenIssuer, time.Hour, "")
+}
+
+func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+	userID, _, err := validateJWT(tokenString, tokenSecret, accessTokenIssuer)
+	return userID, err
 }
 
-func CheckPasswordHash(password, hash string) error {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+// ValidateJWTExpiry is ValidateJWT for connections that outlive the request,
+// which need to know when to stop trusting the token.
+func ValidateJWTExpiry(tokenString, tokenSecret string) (uuid.UUID, time.Time, error) {
+	userID, claims, err := validateJWT(tokenString, tokenSecret, accessTokenIssuer)
+	if err != nil {
+		return uuid.Nil, time.Time{}, err
+	}
+	return userID, claims.ExpiresAt.Time, nil
+}
 
-	return err
+// MFAToken is a validated MFA token. Its ID is recorded when it is used so it
+// can only be exchanged for a session once.
+type MFAToken struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	ExpiresAt time.Time
 }
 
-func MakeJWT(userID uuid.UUID, tokenSecret string) (string, error) {
+// MakeMFAToken creates the short lived token handed out after a correct
+// password when the user still has to enter a second factor. It can't be
+// used as an access token.
+func MakeMFAToken(userID uuid.UUID, tokenSecret string) (string, error) {
+	return makeJWT(userID, tokenSecret, mfaTokenIssuer, 5*time.Minute, uuid.NewString())
+}
+
+func ValidateMFAToken(tokenString, tokenSecret string) (MFAToken, error) {
+	userID, claims, err := validateJWT(tokenString, tokenSecret, mfaTokenIssuer)
+	if err != nil {
+		return MFAToken{}, err
+	}
+
+	id, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return MFAToken{}, err
+	}
+
+	return MFAToken{ID: id, UserID: userID, ExpiresAt: claims.ExpiresAt.Time}, nil
+}
+
+func makeJWT(userID uuid.UUID, tokenSecret, issuer string, expiresIn time.Duration, id string) (string, error) {
 	claims := jwt.RegisteredClaims{
-		Issuer:    "chirpy",
+		ID:        id,
+		Issuer:    issuer,
 		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(time.Hour)),
+		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
 		Subject:   userID.String(),
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -39,29 +80,29 @@ func MakeJWT(userID uuid.UUID, tokenSecret string) (string, error) {
 	return token.SignedString([]byte(tokenSecret))
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+func validateJWT(tokenString, tokenSecret, issuer string) (uuid.UUID, jwt.RegisteredClaims, error) {
 	claims := jwt.RegisteredClaims{}
 	token, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
 		return []byte(tokenSecret), nil
-	})
+	}, jwt.WithIssuer(issuer), jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
 
 	if err != nil {
-		return uuid.Nil, err
+		return uuid.Nil, claims, err
 	}
 
 	tokenUserID, err := token.Claims.GetSubject()
 
 	if err != nil {
-		return uuid.Nil, err
+		return uuid.Nil, claims, err
 	}
 
 	userId, err := uuid.Parse(tokenUserID)
 
 	if err != nil {
-		return uuid.Nil, err
+		return uuid.Nil, claims, err
 	}
 
-	return userId, nil
+	return userId, claims, nil
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -1,9 +1,15 @@
 package auth
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestGetBearerToken(t *testing.T) {
@@ -59,3 +65,407 @@ func TestMakeRefreshToken(t *testing.T) {
 		}
 	})
 }
+
+func TestRoleSatisfies(t *testing.T) {
+	tests := []struct {
+		name     string
+		role     Role
+		required Role
+		want     bool
+	}{
+		{name: "User can access user routes", role: RoleUser, required: RoleUser, want: true},
+		{name: "User cannot access moderator routes", role: RoleUser, required: RoleModerator, want: false},
+		{name: "Moderator cannot access admin routes", role: RoleModerator, required: RoleAdmin, want: false},
+		{name: "Admin can access moderator routes", role: RoleAdmin, required: RoleModerator, want: true},
+		{name: "Unknown role can access nothing", role: Role("root"), required: RoleUser, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.role.Satisfies(tt.required)
+			if got != tt.want {
+				t.Errorf("%s.Satisfies(%s) = %v, want %v", tt.role, tt.required, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRole(t *testing.T) {
+	if _, err := ParseRole("moderator"); err != nil {
+		t.Errorf("ParseRole(moderator) err = %v", err)
+	}
+
+	if _, err := ParseRole("superuser"); err == nil {
+		t.Error("ParseRole(superuser) expected an error")
+	}
+}
+
+func TestLoginThrottleRetryAfter(t *testing.T) {
+	throttle := LoginThrottle{
+		Window:          time.Hour,
+		FreeAttempts:    3,
+		BaseDelay:       time.Second,
+		MaxDelay:        30 * time.Second,
+		LockoutAttempts: 10,
+		LockoutDuration: 15 * time.Minute,
+	}
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		failures     int
+		lastFailedAt time.Time
+		want         time.Duration
+	}{
+		{name: "No failures", failures: 0, lastFailedAt: now, want: 0},
+		{name: "Free attempts have no delay", failures: 3, lastFailedAt: now, want: 0},
+		{name: "First delayed attempt", failures: 4, lastFailedAt: now, want: time.Second},
+		{name: "Delay doubles", failures: 6, lastFailedAt: now, want: 4 * time.Second},
+		{name: "Delay is capped", failures: 9, lastFailedAt: now, want: 30 * time.Second},
+		{name: "Delay already waited out", failures: 6, lastFailedAt: now.Add(-10 * time.Second), want: 0},
+		{name: "Lockout", failures: 10, lastFailedAt: now.Add(-5 * time.Minute), want: 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := throttle.RetryAfter(tt.failures, tt.lastFailedAt, now)
+			if got != tt.want {
+				t.Errorf("RetryAfter(%d) = %v, want %v", tt.failures, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name           string
+		remoteAddr     string
+		forwarded      []string
+		trustedProxies int
+		want           string
+	}{
+		{
+			name:       "Header is ignored without trusted proxies",
+			remoteAddr: "203.0.113.7:5000",
+			forwarded:  []string{"198.51.100.1"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:           "Entry added by the proxy is used",
+			remoteAddr:     "10.0.0.2:5000",
+			forwarded:      []string{"198.51.100.1"},
+			trustedProxies: 1,
+			want:           "198.51.100.1",
+		},
+		{
+			name:           "Spoofed entries before the proxy's are ignored",
+			remoteAddr:     "10.0.0.2:5000",
+			forwarded:      []string{"1.2.3.4, 5.6.7.8, 198.51.100.1"},
+			trustedProxies: 1,
+			want:           "198.51.100.1",
+		},
+		{
+			name:           "Two proxies skip two entries",
+			remoteAddr:     "10.0.0.3:5000",
+			forwarded:      []string{"1.2.3.4, 198.51.100.1", "10.0.0.2"},
+			trustedProxies: 2,
+			want:           "198.51.100.1",
+		},
+		{
+			name:           "Missing header falls back to the remote address",
+			remoteAddr:     "10.0.0.2:5000",
+			trustedProxies: 1,
+			want:           "10.0.0.2",
+		},
+		{
+			name:           "Invalid entry falls back to the remote address",
+			remoteAddr:     "10.0.0.2:5000",
+			forwarded:      []string{"1.2.3.4, not-an-ip"},
+			trustedProxies: 1,
+			want:           "10.0.0.2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, f := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", f)
+			}
+
+			got := ClientIP(r, tt.trustedProxies)
+			if got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 test vectors, truncated to 6 digits. The secret is the ASCII
+	// string "12345678901234567890".
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+	tests := []struct {
+		name string
+		time time.Time
+		want string
+	}{
+		{name: "T = 59", time: time.Unix(59, 0), want: "287082"},
+		{name: "T = 1111111109", time: time.Unix(1111111109, 0), want: "081804"},
+		{name: "T = 2000000000", time: time.Unix(2000000000, 0), want: "279037"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := TOTPCode(secret, tt.time)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+
+	code, err := TOTPCode(secret, now.Add(-30*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	step, ok := ValidateTOTP(secret, code, now, 0)
+	if !ok {
+		t.Error("code from the previous period should be accepted")
+	}
+	if _, ok := ValidateTOTP(secret, code, now, step); ok {
+		t.Error("code should be rejected once its step has been used")
+	}
+
+	oldCode, err := TOTPCode(secret, now.Add(-5*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ValidateTOTP(secret, oldCode, now, 0); oldCode != code && ok {
+		t.Error("code from five minutes ago should be rejected")
+	}
+}
+
+func TestMFATokenIsNotAnAccessToken(t *testing.T) {
+	userID := uuid.New()
+
+	mfaToken, err := MakeMFAToken(userID, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ValidateJWT(mfaToken, "secret"); err == nil {
+		t.Error("ValidateJWT accepted an MFA token")
+	}
+
+	got, err := ValidateMFAToken(mfaToken, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.UserID != userID {
+		t.Errorf("got %s, want %s", got.UserID, userID)
+	}
+	if got.ID == uuid.Nil {
+		t.Error("MFA token has no ID")
+	}
+}
+
+func TestValidateJWTExpiry(t *testing.T) {
+	userId := uuid.New()
+	token, err := MakeJWT(userId, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mfaToken, err := MakeMFAToken(userId, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		secret  string
+		wantErr bool
+	}{
+		{name: "Access token", token: token, secret: "secret"},
+		{name: "Wrong secret", token: token, secret: "other", wantErr: true},
+		{name: "MFA token", token: mfaToken, secret: "secret", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotId, expiresAt, err := ValidateJWTExpiry(tt.token, tt.secret)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateJWTExpiry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if gotId != userId {
+				t.Errorf("ValidateJWTExpiry() user = %v, want %v", gotId, userId)
+			}
+			if until := time.Until(expiresAt); until <= 59*time.Minute || until > time.Hour {
+				t.Errorf("ValidateJWTExpiry() expires in %v, want about an hour", until)
+			}
+		})
+	}
+}
+
+func TestParseScopes(t *testing.T) {
+	tests := []struct {
+		name      string
+		scopes    []string
+		want      string
+		expectErr bool
+	}{
+		{name: "Single scope", scopes: []string{"chirps:read"}, want: "chirps:read"},
+		{name: "Duplicates are removed", scopes: []string{"chirps:write", "profile:write", "chirps:write"}, want: "chirps:write profile:write"},
+		{name: "Unknown scope", scopes: []string{"chirps:read", "admin"}, want: "", expectErr: true},
+		{name: "No scopes", scopes: []string{}, want: "", expectErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseScopes(tt.scopes)
+
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+
+			if (err != nil) != tt.expectErr {
+				t.Errorf("ParseScopes() err = %v, expectErr = %v", err, tt.expectErr)
+			}
+		})
+	}
+}
+
+func TestHasScope(t *testing.T) {
+	if !HasScope("chirps:read chirps:write", ScopeChirpsWrite) {
+		t.Error("expected chirps:write to be granted")
+	}
+
+	if HasScope("chirps:read", ScopeChirpsWrite) {
+		t.Error("chirps:read should not grant chirps:write")
+	}
+}
+
+func TestMakeAPIToken(t *testing.T) {
+	token, err := MakeAPIToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !IsAPIToken(token) {
+		t.Errorf("token %s is missing the API token prefix", token)
+	}
+}
+
+func TestPasswordHashers(t *testing.T) {
+	// Small parameters keep the test fast.
+	params := Argon2idParams{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	hashers := PasswordHashers{
+		Current: Argon2idHasher{Params: params},
+		Legacy:  []PasswordHasher{BcryptHasher{Cost: bcrypt.MinCost}},
+	}
+
+	argonHash, err := hashers.Hash("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(argonHash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Errorf("unexpected hash format %s", argonHash)
+	}
+
+	bcryptHash, err := BcryptHasher{Cost: bcrypt.MinCost}.Hash("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stronger := hashers
+	stronger.Current = Argon2idHasher{Params: Argon2idParams{Memory: 2048, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}}
+
+	tests := []struct {
+		name            string
+		hashers         PasswordHashers
+		password        string
+		hash            string
+		wantNeedsRehash bool
+		wantErr         error
+	}{
+		{name: "Correct password", hashers: hashers, password: "hunter2", hash: argonHash, wantNeedsRehash: false, wantErr: nil},
+		{name: "Wrong password", hashers: hashers, password: "hunter3", hash: argonHash, wantNeedsRehash: false, wantErr: ErrPasswordMismatch},
+		{name: "Outdated parameters", hashers: stronger, password: "hunter2", hash: argonHash, wantNeedsRehash: true, wantErr: nil},
+		{name: "Legacy bcrypt hash", hashers: hashers, password: "hunter2", hash: bcryptHash, wantNeedsRehash: true, wantErr: nil},
+		{name: "Wrong password for legacy hash", hashers: hashers, password: "hunter3", hash: bcryptHash, wantNeedsRehash: false, wantErr: ErrPasswordMismatch},
+		{name: "Empty hash", hashers: hashers, password: "", hash: "", wantNeedsRehash: false, wantErr: ErrUnknownHashFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			needsRehash, err := tt.hashers.Verify(tt.password, tt.hash)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify() err = %v, want %v", err, tt.wantErr)
+			}
+
+			if needsRehash != tt.wantNeedsRehash {
+				t.Errorf("Verify() needsRehash = %v, want %v", needsRehash, tt.wantNeedsRehash)
+			}
+		})
+	}
+}
+
+func TestArgon2idDoesNotTruncate(t *testing.T) {
+	hasher := Argon2idHasher{Params: Argon2idParams{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}}
+	password := strings.Repeat("a", 100)
+
+	hash, err := hasher.Hash(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = hasher.Verify(strings.Repeat("a", 80)+strings.Repeat("b", 20), hash)
+	if !errors.Is(err, ErrPasswordMismatch) {
+		t.Errorf("passwords differing after 72 bytes matched, err = %v", err)
+	}
+}
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	ts := "1700000000"
+	body := []byte(`{"id":"evt_1","event":"user.upgraded"}`)
+	// The empty key stands in for a misconfigured key list.
+	keys := []string{"new-key", "old-key", ""}
+
+	tests := []struct {
+		name      string
+		body      []byte
+		timestamp string
+		signature string
+		wantErr   error
+	}{
+		{name: "Signed with current key", body: body, timestamp: ts, signature: "v1=" + SignWebhook("new-key", ts, body), wantErr: nil},
+		{name: "Signed with rotated out key", body: body, timestamp: ts, signature: "v1=" + SignWebhook("old-key", ts, body), wantErr: nil},
+		{name: "One of several signatures matches", body: body, timestamp: ts, signature: "v1=abcd, v1=" + SignWebhook("old-key", ts, body), wantErr: nil},
+		{name: "Signed with an empty key", body: body, timestamp: ts, signature: "v1=" + SignWebhook("", ts, body), wantErr: ErrInvalidSignature},
+		{name: "Unknown key", body: body, timestamp: ts, signature: "v1=" + SignWebhook("other-key", ts, body), wantErr: ErrInvalidSignature},
+		{name: "Tampered body", body: []byte(`{"id":"evt_1","event":"user.refunded"}`), timestamp: ts, signature: "v1=" + SignWebhook("new-key", ts, body), wantErr: ErrInvalidSignature},
+		{name: "Old timestamp", body: body, timestamp: "1699990000", signature: "v1=" + SignWebhook("new-key", "1699990000", body), wantErr: ErrTimestampOutOfRange},
+		{name: "Missing signature", body: body, timestamp: ts, signature: "", wantErr: ErrMissingSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyWebhookSignature(tt.body, tt.timestamp, tt.signature, keys, 5*time.Minute, now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifyWebhookSignature() err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
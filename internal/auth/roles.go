@@ -0,0 +1,39 @@
+package auth
+
+import "errors"
+
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+var ErrInvalidRole = errors.New("invalid role")
+
+var roleRanks = map[Role]int{
+	RoleUser:      1,
+	RoleModerator: 2,
+	RoleAdmin:     3,
+}
+
+func ParseRole(role string) (Role, error) {
+	r := Role(role)
+	if _, ok := roleRanks[r]; !ok {
+		return "", ErrInvalidRole
+	}
+
+	return r, nil
+}
+
+// Satisfies reports whether a user with role r may access something that
+// requires at least the required role. Admins can do everything moderators can.
+func (r Role) Satisfies(required Role) bool {
+	rank, ok := roleRanks[r]
+	if !ok {
+		return false
+	}
+
+	return rank >= roleRanks[required]
+}
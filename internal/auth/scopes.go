@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"strings"
+)
+
+type Scope string
+
+const (
+	ScopeChirpsRead   Scope = "chirps:read"
+	ScopeChirpsWrite  Scope = "chirps:write"
+	ScopeProfileWrite Scope = "profile:write"
+)
+
+// APITokenPrefix marks personal access tokens so they can be told apart from
+// JWTs without a database lookup.
+const APITokenPrefix = "chirpy_pat_"
+
+var ErrInvalidScope = errors.New("invalid scope")
+
+var validScopes = []Scope{ScopeChirpsRead, ScopeChirpsWrite, ScopeProfileWrite}
+
+// ParseScopes validates requested scopes and returns them in the space
+// separated form they are stored in.
+func ParseScopes(scopes []string) (string, error) {
+	if len(scopes) == 0 {
+		return "", ErrInvalidScope
+	}
+
+	parsed := []string{}
+	for _, s := range scopes {
+		if !slices.Contains(validScopes, Scope(s)) {
+			return "", ErrInvalidScope
+		}
+		if !slices.Contains(parsed, s) {
+			parsed = append(parsed, s)
+		}
+	}
+
+	return strings.Join(parsed, " "), nil
+}
+
+func HasScope(scopes string, scope Scope) bool {
+	return slices.Contains(strings.Fields(scopes), string(scope))
+}
+
+func MakeAPIToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return APITokenPrefix + hex.EncodeToString(b), nil
+}
+
+func IsAPIToken(token string) bool {
+	return strings.HasPrefix(token, APITokenPrefix)
+}
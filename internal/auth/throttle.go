@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// LoginThrottle decides how long a client has to wait before it may try to
+// log in again, based on how many failed attempts it has made recently.
+type LoginThrottle struct {
+	// Window is how far back failed attempts are counted.
+	Window time.Duration
+	// FreeAttempts is the number of failures allowed before delays start.
+	FreeAttempts int
+	// BaseDelay doubles with every failure after FreeAttempts, up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// LockoutAttempts failures lock the client out for LockoutDuration.
+	LockoutAttempts int
+	LockoutDuration time.Duration
+}
+
+// RetryAfter returns how long the client must still wait, or zero if another
+// attempt is allowed right now.
+func (t LoginThrottle) RetryAfter(failures int, lastFailedAt, now time.Time) time.Duration {
+	var wait time.Duration
+
+	switch {
+	case failures >= t.LockoutAttempts:
+		wait = t.LockoutDuration
+	case failures > t.FreeAttempts:
+		wait = t.MaxDelay
+		shift := failures - t.FreeAttempts - 1
+		if shift < 32 && t.BaseDelay<<shift < t.MaxDelay {
+			wait = t.BaseDelay << shift
+		}
+	default:
+		return 0
+	}
+
+	remaining := lastFailedAt.Add(wait).Sub(now)
+	if remaining < 0 {
+		return 0
+	}
+
+	return remaining
+}
+
+// ClientIP returns the address of the client making the request. Behind
+// trustedProxies reverse proxies, each of which appends the address it got
+// the request from to X-Forwarded-For, the client is the entry that many
+// places from the right. Anything further left was sent by the client and
+// can't be trusted. With no trusted proxies the header is ignored.
+func ClientIP(r *http.Request, trustedProxies int) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if trustedProxies <= 0 {
+		return host
+	}
+
+	forwarded := []string{}
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, entry := range strings.Split(header, ",") {
+			forwarded = append(forwarded, strings.TrimSpace(entry))
+		}
+	}
+	if len(forwarded) == 0 {
+		return host
+	}
+
+	// Fewer entries than proxies means the request skipped one of them, so
+	// the leftmost entry is the closest we have to the client.
+	client := forwarded[max(len(forwarded)-trustedProxies, 0)]
+	if net.ParseIP(client) == nil {
+		return host
+	}
+	return client
+}
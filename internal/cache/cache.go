@@ -0,0 +1,75 @@
+// Package cache is a small in-memory cache whose entries expire after a fixed
+// time. It is used for values that are read on most requests but rarely
+// change, where serving a slightly stale value for a few seconds is fine.
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+type entry[V any] struct {
+	value     V
+	expiresAt time.Time
+}
+
+type Cache[K comparable, V any] struct {
+	TTL time.Duration
+	Now func() time.Time
+
+	mu      sync.Mutex
+	entries map[K]entry[V]
+}
+
+func New[K comparable, V any](ttl time.Duration) *Cache[K, V] {
+	return &Cache[K, V]{
+		TTL:     ttl,
+		Now:     time.Now,
+		entries: map[K]entry[V]{},
+	}
+}
+
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok || !c.Now().Before(e.expiresAt) {
+		delete(c.entries, key)
+		var zero V
+		return zero, false
+	}
+	return e.value, true
+}
+
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Expired entries are only removed when they are read, so clear them out
+	// now and then to stop keys that are never read again piling up.
+	if len(c.entries) > 0 && len(c.entries)%1024 == 0 {
+		now := c.Now()
+		for k, e := range c.entries {
+			if !now.Before(e.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+	}
+
+	c.entries[key] = entry[V]{value: value, expiresAt: c.Now().Add(c.TTL)}
+}
+
+func (c *Cache[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, key)
+}
+
+func (c *Cache[K, V]) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = map[K]entry[V]{}
+}
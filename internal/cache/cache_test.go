@@ -0,0 +1,35 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	now := time.Now()
+	c := New[string, int](time.Minute)
+	c.Now = func() time.Time { return now }
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Errorf("Get(a) = %d, %v, want 1, true", v, ok)
+	}
+
+	c.Delete("a")
+	if _, ok := c.Get("a"); ok {
+		t.Error("expected a to be gone after Delete")
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := c.Get("b"); ok {
+		t.Error("expected b to have expired")
+	}
+
+	c.Set("c", 3)
+	c.Clear()
+	if _, ok := c.Get("c"); ok {
+		t.Error("expected c to be gone after Clear")
+	}
+}
@@ -7,23 +7,45 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
 )
 
+const clearChirpShadowHidden = `-- name: ClearChirpShadowHidden :exec
+UPDATE chirps
+SET shadow_hidden_at = NULL
+WHERE id = $1
+`
+
+func (q *Queries) ClearChirpShadowHidden(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, clearChirpShadowHidden, id)
+	return err
+}
+
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
-VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2)
-RETURNING id, created_at, updated_at, body, user_id
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, shadow_hidden_at, publish_at, status)
+VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2, $3, $4, $5)
+RETURNING id, created_at, updated_at, body, user_id, hidden_at, shadow_hidden_at, publish_at, status
 `
 
 type CreateChirpParams struct {
-	Body   string    `json:"body"`
-	UserID uuid.UUID `json:"user_id"`
+	Body           string       `json:"body"`
+	UserID         uuid.UUID    `json:"user_id"`
+	ShadowHiddenAt sql.NullTime `json:"shadow_hidden_at"`
+	PublishAt      sql.NullTime `json:"publish_at"`
+	Status         string       `json:"status"`
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp,
+		arg.Body,
+		arg.UserID,
+		arg.ShadowHiddenAt,
+		arg.PublishAt,
+		arg.Status,
+	)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -31,6 +53,10 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.HiddenAt,
+		&i.ShadowHiddenAt,
+		&i.PublishAt,
+		&i.Status,
 	)
 	return i, err
 }
@@ -45,8 +71,63 @@ func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
 	return err
 }
 
+const deleteScheduledChirp = `-- name: DeleteScheduledChirp :execrows
+DELETE FROM chirps
+WHERE id = $1 AND user_id = $2 AND status = 'scheduled'
+`
+
+type DeleteScheduledChirpParams struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+}
+
+func (q *Queries) DeleteScheduledChirp(ctx context.Context, arg DeleteScheduledChirpParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteScheduledChirp, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getChirpBodiesByUserSince = `-- name: GetChirpBodiesByUserSince :many
+SELECT body FROM chirps
+WHERE user_id = $1 AND created_at > $2 AND id <> $3
+ORDER BY created_at DESC
+`
+
+type GetChirpBodiesByUserSinceParams struct {
+	UserID    uuid.UUID `json:"user_id"`
+	Since     time.Time `json:"since"`
+	ExcludeID uuid.UUID `json:"exclude_id"`
+}
+
+// A chirp being edited is left out so its old text doesn't count against
+// the new.
+func (q *Queries) GetChirpBodiesByUserSince(ctx context.Context, arg GetChirpBodiesByUserSinceParams) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpBodiesByUserSince, arg.UserID, arg.Since, arg.ExcludeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var body string
+		if err := rows.Scan(&body); err != nil {
+			return nil, err
+		}
+		items = append(items, body)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getChirpByID = `-- name: GetChirpByID :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+SELECT id, created_at, updated_at, body, user_id, hidden_at, shadow_hidden_at, publish_at, status FROM chirps
 WHERE id = $1
 `
 
@@ -59,12 +140,41 @@ func (q *Queries) GetChirpByID(ctx context.Context, id uuid.UUID) (Chirp, error)
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.HiddenAt,
+		&i.ShadowHiddenAt,
+		&i.PublishAt,
+		&i.Status,
+	)
+	return i, err
+}
+
+const getChirpForUpdate = `-- name: GetChirpForUpdate :one
+SELECT id, created_at, updated_at, body, user_id, hidden_at, shadow_hidden_at, publish_at, status FROM chirps
+WHERE id = $1
+FOR UPDATE
+`
+
+func (q *Queries) GetChirpForUpdate(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirpForUpdate, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.HiddenAt,
+		&i.ShadowHiddenAt,
+		&i.PublishAt,
+		&i.Status,
 	)
 	return i, err
 }
 
 const getChirps = `-- name: GetChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+SELECT id, created_at, updated_at, body, user_id, hidden_at, shadow_hidden_at, publish_at, status FROM chirps
+WHERE hidden_at IS NULL AND status = 'published'
+  AND user_id NOT IN (SELECT id FROM users WHERE banned_at IS NOT NULL)
 ORDER BY created_at ASC
 `
 
@@ -83,6 +193,10 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.HiddenAt,
+			&i.ShadowHiddenAt,
+			&i.PublishAt,
+			&i.Status,
 		); err != nil {
 			return nil, err
 		}
@@ -98,8 +212,9 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 }
 
 const getChirpsByUserID = `-- name: GetChirpsByUserID :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
-WHERE user_id = $1
+SELECT id, created_at, updated_at, body, user_id, hidden_at, shadow_hidden_at, publish_at, status FROM chirps
+WHERE user_id = $1 AND hidden_at IS NULL AND status = 'published'
+  AND user_id NOT IN (SELECT id FROM users WHERE banned_at IS NOT NULL)
 ORDER BY created_at ASC
 `
 
@@ -118,6 +233,49 @@ func (q *Queries) GetChirpsByUserID(ctx context.Context, userID uuid.UUID) ([]Ch
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.HiddenAt,
+			&i.ShadowHiddenAt,
+			&i.PublishAt,
+			&i.Status,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getScheduledChirpsByUserID = `-- name: GetScheduledChirpsByUserID :many
+SELECT id, created_at, updated_at, body, user_id, hidden_at, shadow_hidden_at, publish_at, status FROM chirps
+WHERE user_id = $1 AND status = 'scheduled'
+ORDER BY publish_at ASC
+`
+
+func (q *Queries) GetScheduledChirpsByUserID(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getScheduledChirpsByUserID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.HiddenAt,
+			&i.ShadowHiddenAt,
+			&i.PublishAt,
+			&i.Status,
 		); err != nil {
 			return nil, err
 		}
@@ -131,3 +289,134 @@ func (q *Queries) GetChirpsByUserID(ctx context.Context, userID uuid.UUID) ([]Ch
 	}
 	return items, nil
 }
+
+const hideChirp = `-- name: HideChirp :exec
+UPDATE chirps
+SET hidden_at = NOW(), updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) HideChirp(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, hideChirp, id)
+	return err
+}
+
+const publishDueChirps = `-- name: PublishDueChirps :many
+UPDATE chirps
+SET status = 'published', created_at = NOW(), updated_at = NOW()
+WHERE id IN (
+  SELECT id FROM chirps
+  WHERE status = 'scheduled' AND publish_at <= NOW()
+  ORDER BY publish_at ASC
+  LIMIT $1
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING id, created_at, updated_at, body, user_id, hidden_at, shadow_hidden_at, publish_at, status
+`
+
+// Rows being published by another server are skipped rather than waited
+// for, so any number of schedulers can run at once without publishing a
+// chirp twice. A published chirp's created_at becomes the time it went out,
+// so it sorts as new in timelines.
+func (q *Queries) PublishDueChirps(ctx context.Context, limit int32) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, publishDueChirps, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.HiddenAt,
+			&i.ShadowHiddenAt,
+			&i.PublishAt,
+			&i.Status,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const rescheduleChirp = `-- name: RescheduleChirp :one
+UPDATE chirps
+SET publish_at = $3, updated_at = NOW()
+WHERE id = $1 AND user_id = $2 AND status = 'scheduled'
+RETURNING id, created_at, updated_at, body, user_id, hidden_at, shadow_hidden_at, publish_at, status
+`
+
+type RescheduleChirpParams struct {
+	ID        uuid.UUID    `json:"id"`
+	UserID    uuid.UUID    `json:"user_id"`
+	PublishAt sql.NullTime `json:"publish_at"`
+}
+
+func (q *Queries) RescheduleChirp(ctx context.Context, arg RescheduleChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, rescheduleChirp, arg.ID, arg.UserID, arg.PublishAt)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.HiddenAt,
+		&i.ShadowHiddenAt,
+		&i.PublishAt,
+		&i.Status,
+	)
+	return i, err
+}
+
+const shadowHideChirp = `-- name: ShadowHideChirp :exec
+UPDATE chirps
+SET shadow_hidden_at = NOW()
+WHERE id = $1 AND shadow_hidden_at IS NULL
+`
+
+func (q *Queries) ShadowHideChirp(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, shadowHideChirp, id)
+	return err
+}
+
+const updateChirpBody = `-- name: UpdateChirpBody :one
+UPDATE chirps
+SET body = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, body, user_id, hidden_at, shadow_hidden_at, publish_at, status
+`
+
+type UpdateChirpBodyParams struct {
+	ID   uuid.UUID `json:"id"`
+	Body string    `json:"body"`
+}
+
+func (q *Queries) UpdateChirpBody(ctx context.Context, arg UpdateChirpBodyParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateChirpBody, arg.ID, arg.Body)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.HiddenAt,
+		&i.ShadowHiddenAt,
+		&i.PublishAt,
+		&i.Status,
+	)
+	return i, err
+}
@@ -6,17 +6,162 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type ApiToken struct {
+	ID         uuid.UUID    `json:"id"`
+	CreatedAt  time.Time    `json:"created_at"`
+	UpdatedAt  time.Time    `json:"updated_at"`
+	UserID     uuid.UUID    `json:"user_id"`
+	Name       string       `json:"name"`
+	TokenHash  string       `json:"token_hash"`
+	Scopes     string       `json:"scopes"`
+	ExpiresAt  sql.NullTime `json:"expires_at"`
+	LastUsedAt sql.NullTime `json:"last_used_at"`
+	RevokedAt  sql.NullTime `json:"revoked_at"`
+}
+
 type Chirp struct {
-	ID        uuid.UUID `json:"id"`
+	ID             uuid.UUID    `json:"id"`
+	CreatedAt      time.Time    `json:"created_at"`
+	UpdatedAt      time.Time    `json:"updated_at"`
+	Body           string       `json:"body"`
+	UserID         uuid.UUID    `json:"user_id"`
+	HiddenAt       sql.NullTime `json:"hidden_at"`
+	ShadowHiddenAt sql.NullTime `json:"shadow_hidden_at"`
+	PublishAt      sql.NullTime `json:"publish_at"`
+	Status         string       `json:"status"`
+}
+
+type ChirpAttachment struct {
+	ID           uuid.UUID `json:"id"`
+	CreatedAt    time.Time `json:"created_at"`
+	ChirpID      uuid.UUID `json:"chirp_id"`
+	Position     int32     `json:"position"`
+	ContentType  string    `json:"content_type"`
+	SizeBytes    int32     `json:"size_bytes"`
+	Width        int32     `json:"width"`
+	Height       int32     `json:"height"`
+	StorageKey   string    `json:"storage_key"`
+	ThumbnailKey string    `json:"thumbnail_key"`
+}
+
+type ChirpLink struct {
+	ChirpID  uuid.UUID `json:"chirp_id"`
+	Position int32     `json:"position"`
+	Url      string    `json:"url"`
+}
+
+type Conversation struct {
+	ID            uuid.UUID    `json:"id"`
+	CreatedAt     time.Time    `json:"created_at"`
+	UpdatedAt     time.Time    `json:"updated_at"`
+	UserAID       uuid.UUID    `json:"user_a_id"`
+	UserBID       uuid.UUID    `json:"user_b_id"`
+	LastMessageAt sql.NullTime `json:"last_message_at"`
+}
+
+type EventPayload struct {
+	ID        int64           `json:"id"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+type LinkPreview struct {
+	Url           string         `json:"url"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	Status        string         `json:"status"`
+	Attempts      int32          `json:"attempts"`
+	NextAttemptAt time.Time      `json:"next_attempt_at"`
+	FetchedAt     sql.NullTime   `json:"fetched_at"`
+	Title         sql.NullString `json:"title"`
+	Description   sql.NullString `json:"description"`
+	ImageUrl      sql.NullString `json:"image_url"`
+	SiteName      sql.NullString `json:"site_name"`
+	LastError     sql.NullString `json:"last_error"`
+}
+
+type LoginAttempt struct {
+	ID        uuid.UUID     `json:"id"`
+	CreatedAt time.Time     `json:"created_at"`
+	Email     string        `json:"email"`
+	IpAddress string        `json:"ip_address"`
+	UserAgent string        `json:"user_agent"`
+	UserID    uuid.NullUUID `json:"user_id"`
+	Succeeded bool          `json:"succeeded"`
+}
+
+type Message struct {
+	ID             uuid.UUID    `json:"id"`
+	CreatedAt      time.Time    `json:"created_at"`
+	ConversationID uuid.UUID    `json:"conversation_id"`
+	SenderID       uuid.UUID    `json:"sender_id"`
+	Body           string       `json:"body"`
+	ReadAt         sql.NullTime `json:"read_at"`
+}
+
+type MfaRecoveryCode struct {
+	ID        uuid.UUID    `json:"id"`
+	CreatedAt time.Time    `json:"created_at"`
+	UserID    uuid.UUID    `json:"user_id"`
+	CodeHash  string       `json:"code_hash"`
+	UsedAt    sql.NullTime `json:"used_at"`
+}
+
+type ModerationAction struct {
+	ID              uuid.UUID      `json:"id"`
+	CreatedAt       time.Time      `json:"created_at"`
+	ModeratorID     uuid.NullUUID  `json:"moderator_id"`
+	Action          string         `json:"action"`
+	ChirpID         uuid.NullUUID  `json:"chirp_id"`
+	TargetUserID    uuid.NullUUID  `json:"target_user_id"`
+	Note            sql.NullString `json:"note"`
+	ReportsResolved int32          `json:"reports_resolved"`
+}
+
+type OidcLoginState struct {
+	State        string    `json:"state"`
+	CreatedAt    time.Time `json:"created_at"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	CodeVerifier string    `json:"code_verifier"`
+	Nonce        string    `json:"nonce"`
+}
+
+type Poll struct {
+	ChirpID   uuid.UUID `json:"chirp_id"`
 	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Body      string    `json:"body"`
+	ClosesAt  time.Time `json:"closes_at"`
+}
+
+type PollOption struct {
+	ChirpID  uuid.UUID `json:"chirp_id"`
+	Position int32     `json:"position"`
+	Text     string    `json:"text"`
+}
+
+type PollVote struct {
+	ChirpID   uuid.UUID `json:"chirp_id"`
 	UserID    uuid.UUID `json:"user_id"`
+	Position  int32     `json:"position"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ProcessedWebhookEvent struct {
+	EventID     string    `json:"event_id"`
+	EventType   string    `json:"event_type"`
+	ProcessedAt time.Time `json:"processed_at"`
+}
+
+type RateLimitBucket struct {
+	Key       string    `json:"key"`
+	Tokens    float64   `json:"tokens"`
+	Allowed   bool      `json:"allowed"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 type RefreshToken struct {
@@ -28,11 +173,110 @@ type RefreshToken struct {
 	UserID    uuid.UUID    `json:"user_id"`
 }
 
+type Report struct {
+	ID         uuid.UUID      `json:"id"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	ChirpID    uuid.UUID      `json:"chirp_id"`
+	ReporterID uuid.NullUUID  `json:"reporter_id"`
+	Reason     string         `json:"reason"`
+	Details    sql.NullString `json:"details"`
+	Status     string         `json:"status"`
+	ResolvedAt sql.NullTime   `json:"resolved_at"`
+	ResolvedBy uuid.NullUUID  `json:"resolved_by"`
+}
+
+type Subscription struct {
+	ID               uuid.UUID `json:"id"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+	UserID           uuid.UUID `json:"user_id"`
+	Plan             string    `json:"plan"`
+	Status           string    `json:"status"`
+	CurrentPeriodEnd time.Time `json:"current_period_end"`
+}
+
+type UsedMfaToken struct {
+	ID        uuid.UUID `json:"id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
 type User struct {
-	ID             uuid.UUID `json:"id"`
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
-	Email          string    `json:"email"`
-	HashedPassword string    `json:"hashed_password"`
-	IsChirpyRed    bool      `json:"is_chirpy_red"`
+	ID               uuid.UUID      `json:"id"`
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+	Email            string         `json:"email"`
+	HashedPassword   string         `json:"hashed_password"`
+	Role             string         `json:"role"`
+	TotpSecret       sql.NullString `json:"totp_secret"`
+	TotpEnabled      bool           `json:"totp_enabled"`
+	SuspendedUntil   sql.NullTime   `json:"suspended_until"`
+	BannedAt         sql.NullTime   `json:"banned_at"`
+	SuspensionReason sql.NullString `json:"suspension_reason"`
+	AvatarKey        sql.NullString `json:"avatar_key"`
+	BannerKey        sql.NullString `json:"banner_key"`
+	TotpLastStep     sql.NullInt64  `json:"totp_last_step"`
+}
+
+type UserBlock struct {
+	BlockerID uuid.UUID `json:"blocker_id"`
+	BlockedID uuid.UUID `json:"blocked_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type UserIdentity struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UserID    uuid.UUID `json:"user_id"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+}
+
+type UserMute struct {
+	MuterID   uuid.UUID `json:"muter_id"`
+	MutedID   uuid.UUID `json:"muted_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type WebhookDelivery struct {
+	ID             uuid.UUID       `json:"id"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+	SubscriptionID uuid.UUID       `json:"subscription_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int32           `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	DeliveredAt    sql.NullTime    `json:"delivered_at"`
+	ResponseStatus sql.NullInt32   `json:"response_status"`
+	LastError      sql.NullString  `json:"last_error"`
+}
+
+type WebhookEvent struct {
+	ID             uuid.UUID       `json:"id"`
+	ReceivedAt     time.Time       `json:"received_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+	Source         string          `json:"source"`
+	Headers        json.RawMessage `json:"headers"`
+	Body           []byte          `json:"body"`
+	SignatureValid bool            `json:"signature_valid"`
+	EventID        sql.NullString  `json:"event_id"`
+	EventType      sql.NullString  `json:"event_type"`
+	Outcome        string          `json:"outcome"`
+	Error          sql.NullString  `json:"error"`
+	ReplayOf       uuid.NullUUID   `json:"replay_of"`
+}
+
+type WebhookSubscription struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UserID    uuid.UUID `json:"user_id"`
+	Url       string    `json:"url"`
+	Secret    string    `json:"secret"`
+	Events    string    `json:"events"`
+	IsGlobal  bool      `json:"is_global"`
 }
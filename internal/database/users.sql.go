@@ -7,15 +7,33 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const banUser = `-- name: BanUser :exec
+UPDATE users
+SET updated_at = NOW(), banned_at = NOW(), suspension_reason = $2
+WHERE id = $1
+`
+
+type BanUserParams struct {
+	ID               uuid.UUID      `json:"id"`
+	SuspensionReason sql.NullString `json:"suspension_reason"`
+}
+
+func (q *Queries) BanUser(ctx context.Context, arg BanUserParams) error {
+	_, err := q.db.ExecContext(ctx, banUser, arg.ID, arg.SuspensionReason)
+	return err
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (id, created_at, updated_at, email, hashed_password)
 VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2)
-RETURNING id, created_at, updated_at, email, is_chirpy_red
+RETURNING id, created_at, updated_at, email, role
 `
 
 type CreateUserParams struct {
@@ -24,11 +42,11 @@ type CreateUserParams struct {
 }
 
 type CreateUserRow struct {
-	ID          uuid.UUID `json:"id"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	Email       string    `json:"email"`
-	IsChirpyRed bool      `json:"is_chirpy_red"`
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (CreateUserRow, error) {
@@ -39,13 +57,73 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (CreateU
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Email,
-		&i.IsChirpyRed,
+		&i.Role,
 	)
 	return i, err
 }
 
+const disableUserTOTP = `-- name: DisableUserTOTP :exec
+UPDATE users
+SET updated_at = NOW(), totp_secret = NULL, totp_enabled = FALSE, totp_last_step = NULL
+WHERE id = $1
+`
+
+func (q *Queries) DisableUserTOTP(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, disableUserTOTP, id)
+	return err
+}
+
+const enableUserTOTP = `-- name: EnableUserTOTP :exec
+UPDATE users
+SET updated_at = NOW(), totp_enabled = TRUE, totp_last_step = $2
+WHERE id = $1
+`
+
+type EnableUserTOTPParams struct {
+	ID           uuid.UUID     `json:"id"`
+	TotpLastStep sql.NullInt64 `json:"totp_last_step"`
+}
+
+func (q *Queries) EnableUserTOTP(ctx context.Context, arg EnableUserTOTPParams) error {
+	_, err := q.db.ExecContext(ctx, enableUserTOTP, arg.ID, arg.TotpLastStep)
+	return err
+}
+
+const getUserAvatarKeys = `-- name: GetUserAvatarKeys :many
+SELECT id, avatar_key FROM users
+WHERE id = ANY($1::uuid[])
+`
+
+type GetUserAvatarKeysRow struct {
+	ID        uuid.UUID      `json:"id"`
+	AvatarKey sql.NullString `json:"avatar_key"`
+}
+
+func (q *Queries) GetUserAvatarKeys(ctx context.Context, userIds []uuid.UUID) ([]GetUserAvatarKeysRow, error) {
+	rows, err := q.db.QueryContext(ctx, getUserAvatarKeys, pq.Array(userIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUserAvatarKeysRow
+	for rows.Next() {
+		var i GetUserAvatarKeysRow
+		if err := rows.Scan(&i.ID, &i.AvatarKey); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users
+SELECT id, created_at, updated_at, email, hashed_password, role, totp_secret, totp_enabled, suspended_until, banned_at, suspension_reason, avatar_key, banner_key, totp_last_step FROM users
 WHERE email = $1
 `
 
@@ -58,16 +136,188 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
-		&i.IsChirpyRed,
+		&i.Role,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.SuspensionReason,
+		&i.AvatarKey,
+		&i.BannerKey,
+		&i.TotpLastStep,
+	)
+	return i, err
+}
+
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, created_at, updated_at, email, hashed_password, role, totp_secret, totp_enabled, suspended_until, banned_at, suspension_reason, avatar_key, banner_key, totp_last_step FROM users
+WHERE id = $1
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.Role,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.SuspensionReason,
+		&i.AvatarKey,
+		&i.BannerKey,
+		&i.TotpLastStep,
+	)
+	return i, err
+}
+
+const getUserByIDForUpdate = `-- name: GetUserByIDForUpdate :one
+SELECT id, created_at, updated_at, email, hashed_password, role, totp_secret, totp_enabled, suspended_until, banned_at, suspension_reason, avatar_key, banner_key, totp_last_step FROM users
+WHERE id = $1
+FOR UPDATE
+`
+
+// Locks the user until the transaction ends, so changes that depend on what
+// was read can't interleave.
+func (q *Queries) GetUserByIDForUpdate(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByIDForUpdate, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.Role,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.SuspensionReason,
+		&i.AvatarKey,
+		&i.BannerKey,
+		&i.TotpLastStep,
+	)
+	return i, err
+}
+
+const setUserAvatarKey = `-- name: SetUserAvatarKey :exec
+UPDATE users
+SET updated_at = NOW(), avatar_key = $2
+WHERE id = $1
+`
+
+type SetUserAvatarKeyParams struct {
+	ID        uuid.UUID      `json:"id"`
+	AvatarKey sql.NullString `json:"avatar_key"`
+}
+
+func (q *Queries) SetUserAvatarKey(ctx context.Context, arg SetUserAvatarKeyParams) error {
+	_, err := q.db.ExecContext(ctx, setUserAvatarKey, arg.ID, arg.AvatarKey)
+	return err
+}
+
+const setUserBannerKey = `-- name: SetUserBannerKey :exec
+UPDATE users
+SET updated_at = NOW(), banner_key = $2
+WHERE id = $1
+`
+
+type SetUserBannerKeyParams struct {
+	ID        uuid.UUID      `json:"id"`
+	BannerKey sql.NullString `json:"banner_key"`
+}
+
+func (q *Queries) SetUserBannerKey(ctx context.Context, arg SetUserBannerKeyParams) error {
+	_, err := q.db.ExecContext(ctx, setUserBannerKey, arg.ID, arg.BannerKey)
+	return err
+}
+
+const setUserRole = `-- name: SetUserRole :one
+UPDATE users
+SET updated_at = NOW(), role = $2
+WHERE id = $1
+RETURNING id, email, updated_at, role
+`
+
+type SetUserRoleParams struct {
+	ID   uuid.UUID `json:"id"`
+	Role string    `json:"role"`
+}
+
+type SetUserRoleRow struct {
+	ID        uuid.UUID `json:"id"`
+	Email     string    `json:"email"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Role      string    `json:"role"`
+}
+
+func (q *Queries) SetUserRole(ctx context.Context, arg SetUserRoleParams) (SetUserRoleRow, error) {
+	row := q.db.QueryRowContext(ctx, setUserRole, arg.ID, arg.Role)
+	var i SetUserRoleRow
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.UpdatedAt,
+		&i.Role,
 	)
 	return i, err
 }
 
+const setUserTOTPSecret = `-- name: SetUserTOTPSecret :exec
+UPDATE users
+SET updated_at = NOW(), totp_secret = $2, totp_enabled = FALSE, totp_last_step = NULL
+WHERE id = $1
+`
+
+type SetUserTOTPSecretParams struct {
+	ID         uuid.UUID      `json:"id"`
+	TotpSecret sql.NullString `json:"totp_secret"`
+}
+
+func (q *Queries) SetUserTOTPSecret(ctx context.Context, arg SetUserTOTPSecretParams) error {
+	_, err := q.db.ExecContext(ctx, setUserTOTPSecret, arg.ID, arg.TotpSecret)
+	return err
+}
+
+const suspendUser = `-- name: SuspendUser :exec
+UPDATE users
+SET updated_at = NOW(), suspended_until = $2, suspension_reason = $3
+WHERE id = $1
+`
+
+type SuspendUserParams struct {
+	ID               uuid.UUID      `json:"id"`
+	SuspendedUntil   sql.NullTime   `json:"suspended_until"`
+	SuspensionReason sql.NullString `json:"suspension_reason"`
+}
+
+func (q *Queries) SuspendUser(ctx context.Context, arg SuspendUserParams) error {
+	_, err := q.db.ExecContext(ctx, suspendUser, arg.ID, arg.SuspendedUntil, arg.SuspensionReason)
+	return err
+}
+
+const unsuspendUser = `-- name: UnsuspendUser :exec
+UPDATE users
+SET updated_at = NOW(), suspended_until = NULL, banned_at = NULL, suspension_reason = NULL
+WHERE id = $1
+`
+
+func (q *Queries) UnsuspendUser(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, unsuspendUser, id)
+	return err
+}
+
 const updateUser = `-- name: UpdateUser :one
 UPDATE users
 SET updated_at = NOW(), email = $2, hashed_password = $3
 WHERE id = $1
-RETURNING id, email, created_at, updated_at, is_chirpy_red
+RETURNING id, email, created_at, updated_at, role, avatar_key, banner_key
 `
 
 type UpdateUserParams struct {
@@ -77,11 +327,13 @@ type UpdateUserParams struct {
 }
 
 type UpdateUserRow struct {
-	ID          uuid.UUID `json:"id"`
-	Email       string    `json:"email"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	IsChirpyRed bool      `json:"is_chirpy_red"`
+	ID        uuid.UUID      `json:"id"`
+	Email     string         `json:"email"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	Role      string         `json:"role"`
+	AvatarKey sql.NullString `json:"avatar_key"`
+	BannerKey sql.NullString `json:"banner_key"`
 }
 
 func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (UpdateUserRow, error) {
@@ -92,33 +344,52 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (UpdateU
 		&i.Email,
 		&i.CreatedAt,
 		&i.UpdatedAt,
-		&i.IsChirpyRed,
+		&i.Role,
+		&i.AvatarKey,
+		&i.BannerKey,
 	)
 	return i, err
 }
 
-const upgradeUser = `-- name: UpgradeUser :one
+const updateUserPasswordHash = `-- name: UpdateUserPasswordHash :execrows
 UPDATE users
-SET updated_at = NOW(), is_chirpy_red = true
-WHERE id = $1
-RETURNING id, email, updated_at, is_chirpy_red
+SET hashed_password = $1
+WHERE id = $2 AND hashed_password = $3
 `
 
-type UpgradeUserRow struct {
-	ID          uuid.UUID `json:"id"`
-	Email       string    `json:"email"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	IsChirpyRed bool      `json:"is_chirpy_red"`
+type UpdateUserPasswordHashParams struct {
+	NewHash string    `json:"new_hash"`
+	ID      uuid.UUID `json:"id"`
+	OldHash string    `json:"old_hash"`
 }
 
-func (q *Queries) UpgradeUser(ctx context.Context, id uuid.UUID) (UpgradeUserRow, error) {
-	row := q.db.QueryRowContext(ctx, upgradeUser, id)
-	var i UpgradeUserRow
-	err := row.Scan(
-		&i.ID,
-		&i.Email,
-		&i.UpdatedAt,
-		&i.IsChirpyRed,
-	)
-	return i, err
+// Only the hash that was verified is replaced, so a password changed in the
+// meantime isn't put back.
+func (q *Queries) UpdateUserPasswordHash(ctx context.Context, arg UpdateUserPasswordHashParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, updateUserPasswordHash, arg.NewHash, arg.ID, arg.OldHash)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const useTOTPStep = `-- name: UseTOTPStep :execrows
+UPDATE users
+SET totp_last_step = $2
+WHERE id = $1 AND (totp_last_step IS NULL OR totp_last_step < $2)
+`
+
+type UseTOTPStepParams struct {
+	ID           uuid.UUID     `json:"id"`
+	TotpLastStep sql.NullInt64 `json:"totp_last_step"`
+}
+
+// The step is checked and recorded in one statement so two requests can't
+// both use the same code.
+func (q *Queries) UseTOTPStep(ctx context.Context, arg UseTOTPStepParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, useTOTPStep, arg.ID, arg.TotpLastStep)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
@@ -0,0 +1,50 @@
+// Package entitlements decides what a user is allowed to do based on whether
+// they have Chirpy Red. Handlers ask for a user's Entitlements instead of
+// checking Chirpy Red themselves, so the perks are defined in one place.
+package entitlements
+
+import (
+	"time"
+	"unicode/utf8"
+)
+
+const BadgeChirpyRed = "chirpy_red"
+
+type Entitlements struct {
+	// MaxChirpLength is in characters, not bytes.
+	MaxChirpLength  int
+	ChirpsPerMinute int
+	// EditWindow is how long after posting a chirp can still be edited. Zero
+	// means chirps can't be edited at all.
+	EditWindow time.Duration
+	Badges     []string
+}
+
+var Free = Entitlements{
+	MaxChirpLength:  140,
+	ChirpsPerMinute: 5,
+	EditWindow:      0,
+	Badges:          []string{},
+}
+
+var ChirpyRed = Entitlements{
+	MaxChirpLength:  1000,
+	ChirpsPerMinute: 20,
+	EditWindow:      15 * time.Minute,
+	Badges:          []string{BadgeChirpyRed},
+}
+
+func For(isChirpyRed bool) Entitlements {
+	if isChirpyRed {
+		return ChirpyRed
+	}
+	return Free
+}
+
+func (e Entitlements) AllowsChirpLength(body string) bool {
+	return utf8.RuneCountInString(body) <= e.MaxChirpLength
+}
+
+func (e Entitlements) CanEditChirp(createdAt, now time.Time) bool {
+	return e.EditWindow > 0 && now.Sub(createdAt) <= e.EditWindow
+}
@@ -0,0 +1,52 @@
+package entitlements
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAllowsChirpLength(t *testing.T) {
+	tests := []struct {
+		name         string
+		entitlements Entitlements
+		body         string
+		want         bool
+	}{
+		{name: "Free at the limit", entitlements: Free, body: strings.Repeat("a", 140), want: true},
+		{name: "Free over the limit", entitlements: Free, body: strings.Repeat("a", 141), want: false},
+		{name: "Multi-byte characters count once", entitlements: Free, body: strings.Repeat("é", 140), want: true},
+		{name: "Chirpy Red over the free limit", entitlements: ChirpyRed, body: strings.Repeat("a", 500), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.entitlements.AllowsChirpLength(tt.body)
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanEditChirp(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name         string
+		entitlements Entitlements
+		createdAt    time.Time
+		want         bool
+	}{
+		{name: "Free users can't edit", entitlements: Free, createdAt: now, want: false},
+		{name: "Chirpy Red inside the window", entitlements: ChirpyRed, createdAt: now.Add(-5 * time.Minute), want: true},
+		{name: "Chirpy Red after the window", entitlements: ChirpyRed, createdAt: now.Add(-time.Hour), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.entitlements.CanEditChirp(tt.createdAt, now)
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
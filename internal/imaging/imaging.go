@@ -0,0 +1,158 @@
+// Package imaging checks uploaded images and makes thumbnails and fixed size
+// copies of them.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// MaxPixels stops small files that decode to enormous images from using up
+// the server's memory.
+const MaxPixels = 40_000_000
+
+var (
+	ErrUnsupportedType = errors.New("image must be a JPEG, PNG or GIF")
+	ErrTooManyPixels   = errors.New("image dimensions are too large")
+)
+
+// Extensions for the supported content types.
+var Extensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+type Info struct {
+	ContentType string
+	Width       int
+	Height      int
+}
+
+// Inspect works out an upload's type from its content rather than trusting
+// the name or Content-Type the client sent, and checks it is an image that
+// can be decoded.
+func Inspect(data []byte) (Info, error) {
+	contentType := http.DetectContentType(data)
+	if _, ok := Extensions[contentType]; !ok {
+		return Info{}, ErrUnsupportedType
+	}
+
+	config, err := decodeConfig(contentType, data)
+	if err != nil {
+		return Info{}, err
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return Info{}, ErrUnsupportedType
+	}
+	if config.Width*config.Height > MaxPixels {
+		return Info{}, ErrTooManyPixels
+	}
+
+	return Info{ContentType: contentType, Width: config.Width, Height: config.Height}, nil
+}
+
+func decodeConfig(contentType string, data []byte) (image.Config, error) {
+	r := bytes.NewReader(data)
+	switch contentType {
+	case "image/jpeg":
+		return jpeg.DecodeConfig(r)
+	case "image/png":
+		return png.DecodeConfig(r)
+	case "image/gif":
+		return gif.DecodeConfig(r)
+	}
+	return image.Config{}, ErrUnsupportedType
+}
+
+func decode(contentType string, data []byte) (image.Image, error) {
+	r := bytes.NewReader(data)
+	switch contentType {
+	case "image/jpeg":
+		return jpeg.Decode(r)
+	case "image/png":
+		return png.Decode(r)
+	case "image/gif":
+		// Only the first frame of an animated GIF is used.
+		return gif.Decode(r)
+	}
+	return nil, ErrUnsupportedType
+}
+
+// Thumbnail scales an image down to fit within maxSize by maxSize and
+// encodes it as a JPEG. Images that already fit are only re-encoded.
+// Transparent areas become white.
+func Thumbnail(data []byte, info Info, maxSize int) ([]byte, error) {
+	src, err := decode(info.ContentType, data)
+	if err != nil {
+		return nil, err
+	}
+
+	width, height := fit(info.Width, info.Height, maxSize)
+	return scaleToJPEG(src, src.Bounds(), width, height)
+}
+
+// Cover scales and crops an image so it fills exactly width by height,
+// cutting equal amounts off whichever sides don't fit the aspect ratio, and
+// encodes it as a JPEG. Smaller images are enlarged. Transparent areas
+// become white.
+func Cover(data []byte, info Info, width, height int) ([]byte, error) {
+	src, err := decode(info.ContentType, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return scaleToJPEG(src, crop(src.Bounds(), width, height), width, height)
+}
+
+func scaleToJPEG(src image.Image, srcRect image.Rectangle, width, height int) ([]byte, error) {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), src, srcRect, draw.Over, nil)
+
+	buf := bytes.Buffer{}
+	err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// crop returns the largest centred part of bounds with the same aspect ratio
+// as width by height.
+func crop(bounds image.Rectangle, width, height int) image.Rectangle {
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+
+	cropWidth, cropHeight := srcWidth, srcHeight
+	if srcWidth*height > srcHeight*width {
+		cropWidth = max(1, srcHeight*width/height)
+	} else {
+		cropHeight = max(1, srcWidth*height/width)
+	}
+
+	x := bounds.Min.X + (srcWidth-cropWidth)/2
+	y := bounds.Min.Y + (srcHeight-cropHeight)/2
+	return image.Rect(x, y, x+cropWidth, y+cropHeight)
+}
+
+// fit returns the size of a width by height image scaled down, keeping its
+// aspect ratio, to fit within maxSize by maxSize.
+func fit(width, height, maxSize int) (int, int) {
+	if width <= maxSize && height <= maxSize {
+		return width, height
+	}
+
+	if width >= height {
+		return maxSize, max(1, height*maxSize/width)
+	}
+	return max(1, width*maxSize/height), maxSize
+}
@@ -0,0 +1,174 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func encodedImage(t *testing.T, format string, width, height int) []byte {
+	t.Helper()
+
+	img := image.NewPaletted(image.Rect(0, 0, width, height), color.Palette{color.White, color.Black})
+	buf := bytes.Buffer{}
+
+	var err error
+	switch format {
+	case "png":
+		err = png.Encode(&buf, img)
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, nil)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatalf("encoding %s: %v", format, err)
+	}
+	return buf.Bytes()
+}
+
+func TestInspect(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		wantType string
+		wantErr  bool
+		// wantErrIs is checked with errors.Is when set.
+		wantErrIs error
+	}{
+		{
+			name:     "PNG",
+			data:     encodedImage(t, "png", 40, 20),
+			wantType: "image/png",
+		},
+		{
+			name:     "JPEG",
+			data:     encodedImage(t, "jpeg", 40, 20),
+			wantType: "image/jpeg",
+		},
+		{
+			name:     "GIF",
+			data:     encodedImage(t, "gif", 40, 20),
+			wantType: "image/gif",
+		},
+		{
+			name:      "HTML pretending to be an image",
+			data:      []byte("<html><script>alert(1)</script></html>"),
+			wantErr:   true,
+			wantErrIs: ErrUnsupportedType,
+		},
+		{
+			name:    "Truncated PNG",
+			data:    encodedImage(t, "png", 40, 20)[:20],
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := Inspect(tt.data)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Inspect() error = nil, want an error")
+				}
+				if tt.wantErrIs != nil && !errors.Is(err, tt.wantErrIs) {
+					t.Errorf("Inspect() error = %v, want %v", err, tt.wantErrIs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Inspect() error = %v", err)
+			}
+			if info.ContentType != tt.wantType || info.Width != 40 || info.Height != 20 {
+				t.Errorf("Inspect() = %+v, want %s 40x20", info, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	tests := []struct {
+		name       string
+		width      int
+		height     int
+		wantWidth  int
+		wantHeight int
+	}{
+		{name: "Wide image", width: 800, height: 400, wantWidth: 200, wantHeight: 100},
+		{name: "Tall image", width: 300, height: 600, wantWidth: 100, wantHeight: 200},
+		{name: "Small image is not enlarged", width: 50, height: 30, wantWidth: 50, wantHeight: 30},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := encodedImage(t, "png", tt.width, tt.height)
+			info, err := Inspect(data)
+			if err != nil {
+				t.Fatalf("Inspect() error = %v", err)
+			}
+
+			thumb, err := Thumbnail(data, info, 200)
+			if err != nil {
+				t.Fatalf("Thumbnail() error = %v", err)
+			}
+
+			config, err := jpeg.DecodeConfig(bytes.NewReader(thumb))
+			if err != nil {
+				t.Fatalf("thumbnail isn't a JPEG: %v", err)
+			}
+			if config.Width != tt.wantWidth || config.Height != tt.wantHeight {
+				t.Errorf("thumbnail is %dx%d, want %dx%d", config.Width, config.Height, tt.wantWidth, tt.wantHeight)
+			}
+		})
+	}
+}
+
+func TestCrop(t *testing.T) {
+	tests := []struct {
+		name   string
+		bounds image.Rectangle
+		width  int
+		height int
+		want   image.Rectangle
+	}{
+		{name: "Wide image to square", bounds: image.Rect(0, 0, 800, 400), width: 100, height: 100, want: image.Rect(200, 0, 600, 400)},
+		{name: "Tall image to square", bounds: image.Rect(0, 0, 300, 600), width: 100, height: 100, want: image.Rect(0, 150, 300, 450)},
+		{name: "Square image to banner", bounds: image.Rect(0, 0, 600, 600), width: 1500, height: 500, want: image.Rect(0, 200, 600, 400)},
+		{name: "Same aspect ratio is not cropped", bounds: image.Rect(0, 0, 300, 100), width: 1500, height: 500, want: image.Rect(0, 0, 300, 100)},
+		{name: "Offset bounds", bounds: image.Rect(10, 10, 30, 20), width: 1, height: 1, want: image.Rect(15, 10, 25, 20)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := crop(tt.bounds, tt.width, tt.height); got != tt.want {
+				t.Errorf("crop() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCover(t *testing.T) {
+	data := encodedImage(t, "gif", 50, 300)
+	info, err := Inspect(data)
+	if err != nil {
+		t.Fatalf("Inspect() error = %v", err)
+	}
+
+	out, err := Cover(data, info, 400, 400)
+	if err != nil {
+		t.Fatalf("Cover() error = %v", err)
+	}
+
+	config, err := jpeg.DecodeConfig(bytes.NewReader(out))
+	if err != nil {
+		t.Fatalf("output isn't a JPEG: %v", err)
+	}
+	if config.Width != 400 || config.Height != 400 {
+		t.Errorf("output is %dx%d, want 400x400", config.Width, config.Height)
+	}
+}
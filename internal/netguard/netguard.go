@@ -0,0 +1,105 @@
+// Package netguard stops the server being used to reach internal services
+// when it makes requests to URLs chosen by users, such as link previews and
+// outgoing webhooks.
+package netguard
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var ErrBlockedAddress = errors.New("address is not publicly routable")
+
+// NewClient returns an http.Client that will only connect to public
+// addresses. The check is made on the address actually dialled, after DNS
+// lookup and on every redirect, so a hostname can't be pointed at an
+// internal service. checkRedirect is used as the client's CheckRedirect.
+func NewClient(timeout time.Duration, checkRedirect func(*http.Request, []*http.Request) error) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: Control,
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// Going through a proxy would mean only the proxy's address was
+			// checked.
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   timeout,
+			ResponseHeaderTimeout: timeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       time.Minute,
+		},
+		CheckRedirect: checkRedirect,
+	}
+}
+
+// Control is a net.Dialer Control function that refuses to connect to
+// blocked addresses.
+func Control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+
+	if IsBlocked(addr) {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, addr)
+	}
+	return nil
+}
+
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	// NAT64 addresses can reach any IPv4 address, private ones included.
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// IsBlocked reports whether addr is loopback, private, link local or
+// otherwise not somewhere a public service could be.
+func IsBlocked(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return true
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsBlockedHost reports whether a URL's host is obviously internal: a
+// blocked IP address or localhost. Other hostnames can still resolve to a
+// blocked address, which is only caught when they are dialled, so this is
+// for giving early feedback rather than a replacement for NewClient.
+func IsBlockedHost(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+
+	addr, err := netip.ParseAddr(strings.Trim(host, "[]"))
+	if err != nil {
+		return false
+	}
+	return IsBlocked(addr)
+}
@@ -0,0 +1,60 @@
+package netguard
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestIsBlocked(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{addr: "93.184.216.34", want: false},
+		{addr: "2606:2800:220:1:248:1893:25c8:1946", want: false},
+		{addr: "127.0.0.1", want: true},
+		{addr: "10.1.2.3", want: true},
+		{addr: "172.16.0.1", want: true},
+		{addr: "192.168.1.1", want: true},
+		{addr: "169.254.169.254", want: true},
+		{addr: "100.64.0.1", want: true},
+		{addr: "0.0.0.0", want: true},
+		{addr: "::1", want: true},
+		{addr: "fd00::1", want: true},
+		{addr: "fe80::1", want: true},
+		{addr: "::ffff:127.0.0.1", want: true},
+		{addr: "64:ff9b::a00:1", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if got := IsBlocked(netip.MustParseAddr(tt.addr)); got != tt.want {
+				t.Errorf("IsBlocked(%s) = %v, want %v", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsBlockedHost(t *testing.T) {
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{host: "example.com", want: false},
+		{host: "93.184.216.34", want: false},
+		{host: "localhost", want: true},
+		{host: "LOCALHOST.", want: true},
+		{host: "db.localhost", want: true},
+		{host: "169.254.169.254", want: true},
+		{host: "[::1]", want: true},
+		{host: "::ffff:10.0.0.1", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			if got := IsBlockedHost(tt.host); got != tt.want {
+				t.Errorf("IsBlockedHost(%s) = %v, want %v", tt.host, got, tt.want)
+			}
+		})
+	}
+}
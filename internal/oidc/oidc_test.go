@@ -0,0 +1,205 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockProvider is a minimal OIDC provider. Codes are handed out by the test
+// directly instead of through a login page.
+type mockProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	// codes maps an authorization code to the PKCE challenge and nonce it
+	// was issued for.
+	codes map[string][2]string
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &mockProvider{key: key, codes: map[string][2]string{}}
+	mux := http.NewServeMux()
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.server.URL,
+			"authorization_endpoint": m.server.URL + "/authorize",
+			"token_endpoint":         m.server.URL + "/token",
+			"jwks_uri":               m.server.URL + "/jwks",
+		})
+	})
+
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test-key",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		issued, ok := m.codes[r.PostForm.Get("code")]
+		if !ok || CodeChallenge(r.PostForm.Get("code_verifier")) != issued[0] {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		claims := idTokenClaims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    m.server.URL,
+				Subject:   "mock-user-1",
+				Audience:  jwt.ClaimStrings{r.PostForm.Get("client_id")},
+				IssuedAt:  jwt.NewNumericDate(time.Now()),
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			},
+			Nonce:         issued[1],
+			Email:         "user@example.com",
+			EmailVerified: true,
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "test-key"
+		idToken, err := token.SignedString(key)
+		if err != nil {
+			t.Error(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "mock-access-token",
+			"token_type":   "Bearer",
+			"id_token":     idToken,
+		})
+	})
+
+	return m
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	mock := newMockProvider(t)
+	provider := NewProvider(Config{
+		Issuer:      mock.server.URL,
+		ClientID:    "chirpy",
+		RedirectURL: "http://localhost:8080/api/auth/oidc/callback",
+	}, mock.server.Client())
+
+	got, err := provider.AuthCodeURL(context.Background(), "state-1", "challenge-1", "nonce-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"client_id":             "chirpy",
+		"state":                 "state-1",
+		"nonce":                 "nonce-1",
+		"code_challenge":        "challenge-1",
+		"code_challenge_method": "S256",
+		"scope":                 "openid email",
+	}
+	for k, v := range want {
+		if u.Query().Get(k) != v {
+			t.Errorf("%s = %q, want %q", k, u.Query().Get(k), v)
+		}
+	}
+}
+
+func TestExchange(t *testing.T) {
+	mock := newMockProvider(t)
+	provider := NewProvider(Config{
+		Issuer:      mock.server.URL,
+		ClientID:    "chirpy",
+		RedirectURL: "http://localhost:8080/api/auth/oidc/callback",
+	}, mock.server.Client())
+
+	verifier, err := RandomString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock.codes["good-code"] = [2]string{CodeChallenge(verifier), "nonce-1"}
+
+	tests := []struct {
+		name      string
+		code      string
+		verifier  string
+		nonce     string
+		expectErr bool
+	}{
+		{name: "Valid code", code: "good-code", verifier: verifier, nonce: "nonce-1", expectErr: false},
+		{name: "Wrong code verifier", code: "good-code", verifier: "not-the-verifier", nonce: "nonce-1", expectErr: true},
+		{name: "Wrong nonce", code: "good-code", verifier: verifier, nonce: "nonce-2", expectErr: true},
+		{name: "Unknown code", code: "bad-code", verifier: verifier, nonce: "nonce-1", expectErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity, err := provider.Exchange(context.Background(), tt.code, tt.verifier, tt.nonce)
+
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("Exchange() err = %v, expectErr = %v", err, tt.expectErr)
+			}
+
+			if !tt.expectErr && (identity.Subject != "mock-user-1" || identity.Email != "user@example.com" || !identity.EmailVerified) {
+				t.Errorf("got unexpected identity %+v", identity)
+			}
+		})
+	}
+}
+
+func TestExchangeRejectsOtherAudience(t *testing.T) {
+	mock := newMockProvider(t)
+	provider := NewProvider(Config{
+		Issuer:   mock.server.URL,
+		ClientID: "chirpy",
+	}, mock.server.Client())
+
+	md, err := provider.discover(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := idTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    mock.server.URL,
+			Subject:   "mock-user-1",
+			Audience:  jwt.ClaimStrings{"someone-else"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+		Nonce: "nonce-1",
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test-key"
+	idToken, err := token.SignedString(mock.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = provider.verifyIDToken(context.Background(), md, idToken, "nonce-1")
+	if err == nil {
+		t.Error("expected an ID token for another audience to be rejected")
+	}
+}
@@ -0,0 +1,152 @@
+// Package pubsub fans events out to subscribers inside one server process.
+// Recent events are kept in a ring buffer so a subscriber that reconnects can
+// pick up from the last event it saw.
+package pubsub
+
+import (
+	"encoding/json"
+	"slices"
+	"sync"
+)
+
+type Event struct {
+	ID     uint64          `json:"id"`
+	Type   string          `json:"type"`
+	Topics []string        `json:"topics"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// HasTopic reports whether the event was published to the topic.
+func (e Event) HasTopic(topic string) bool {
+	return slices.Contains(e.Topics, topic)
+}
+
+type Subscription struct {
+	// C is closed when the subscription ends, either because Unsubscribe
+	// was called or because the subscriber fell too far behind.
+	C <-chan Event
+
+	c      chan Event
+	filter func(Event) bool
+	broker *Broker
+}
+
+func (s *Subscription) Unsubscribe() {
+	s.broker.remove(s)
+}
+
+type Broker struct {
+	mu          sync.Mutex
+	subscribers map[*Subscription]struct{}
+	lastID      uint64
+
+	// history is a ring buffer of the most recent events. next is where the
+	// next event goes and full is set once it has wrapped around.
+	history []Event
+	next    int
+	full    bool
+}
+
+// NewBroker returns a Broker that keeps the last historySize events for
+// resuming subscribers.
+func NewBroker(historySize int) *Broker {
+	return &Broker{
+		subscribers: map[*Subscription]struct{}{},
+		history:     make([]Event, historySize),
+	}
+}
+
+// Publish delivers the event to every matching subscriber. Events without an
+// ID are given the next one; events that already have one, such as those
+// relayed from another server, keep it. Publish never blocks: a subscriber
+// whose buffer is full is dropped and has to resubscribe.
+func (b *Broker) Publish(e Event) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if e.ID == 0 {
+		e.ID = b.lastID + 1
+	}
+	b.lastID = max(b.lastID, e.ID)
+
+	if len(b.history) > 0 {
+		b.history[b.next] = e
+		b.next = (b.next + 1) % len(b.history)
+		if b.next == 0 {
+			b.full = true
+		}
+	}
+
+	for s := range b.subscribers {
+		if s.filter != nil && !s.filter(e) {
+			continue
+		}
+		select {
+		case s.c <- e:
+		default:
+			delete(b.subscribers, s)
+			close(s.c)
+		}
+	}
+
+	return e
+}
+
+// Subscribe returns a subscription to events matching filter. A nil filter
+// matches every event.
+func (b *Broker) Subscribe(filter func(Event) bool, buffer int) *Subscription {
+	s, _, _ := b.SubscribeSince(0, filter, buffer)
+	return s
+}
+
+// SubscribeSince subscribes like Subscribe and also returns the matching
+// events published after lastID. Both happen under one lock so no event is
+// missed or sent twice in between. complete is false when events after
+// lastID have already dropped out of the history. A lastID of 0 returns no
+// history.
+func (b *Broker) SubscribeSince(lastID uint64, filter func(Event) bool, buffer int) (sub *Subscription, missed []Event, complete bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := make(chan Event, buffer)
+	sub = &Subscription{C: c, c: c, filter: filter, broker: b}
+	b.subscribers[sub] = struct{}{}
+
+	if lastID == 0 || lastID >= b.lastID {
+		return sub, nil, true
+	}
+
+	// Relayed events can arrive slightly out of order, so the oldest event
+	// kept is the one with the lowest ID rather than the first in the buffer.
+	history := b.ordered()
+	oldest := uint64(0)
+	for _, e := range history {
+		if oldest == 0 || e.ID < oldest {
+			oldest = e.ID
+		}
+		if e.ID > lastID && (filter == nil || filter(e)) {
+			missed = append(missed, e)
+		}
+	}
+	complete = oldest != 0 && oldest <= lastID+1
+
+	return sub, missed, complete
+}
+
+func (b *Broker) remove(s *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[s]; ok {
+		delete(b.subscribers, s)
+		close(s.c)
+	}
+}
+
+// ordered returns the history oldest first.
+func (b *Broker) ordered() []Event {
+	if !b.full {
+		return slices.Clone(b.history[:b.next])
+	}
+	return append(slices.Clone(b.history[b.next:]), b.history[:b.next]...)
+}
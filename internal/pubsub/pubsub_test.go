@@ -0,0 +1,115 @@
+package pubsub
+
+import (
+	"testing"
+)
+
+func TestPublishFiltersSubscribers(t *testing.T) {
+	b := NewBroker(10)
+
+	all := b.Subscribe(nil, 10)
+	defer all.Unsubscribe()
+	alice := b.Subscribe(func(e Event) bool { return e.HasTopic("user:alice") }, 10)
+	defer alice.Unsubscribe()
+
+	b.Publish(Event{Type: "chirp.created", Topics: []string{"timeline", "user:bob"}})
+	b.Publish(Event{Type: "chirp.created", Topics: []string{"timeline", "user:alice"}})
+
+	if got := len(all.C); got != 2 {
+		t.Errorf("unfiltered subscriber got %d events, want 2", got)
+	}
+	if got := len(alice.C); got != 1 {
+		t.Fatalf("filtered subscriber got %d events, want 1", got)
+	}
+	if e := <-alice.C; e.ID != 2 {
+		t.Errorf("filtered subscriber got event %d, want 2", e.ID)
+	}
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	b := NewBroker(10)
+	sub := b.Subscribe(nil, 1)
+
+	b.Publish(Event{Type: "a"})
+	b.Publish(Event{Type: "b"})
+
+	<-sub.C
+	if _, ok := <-sub.C; ok {
+		t.Fatal("expected the subscription to be closed after its buffer filled")
+	}
+
+	// Unsubscribing after being dropped must not panic.
+	sub.Unsubscribe()
+}
+
+func TestSubscribeSince(t *testing.T) {
+	tests := []struct {
+		name         string
+		historySize  int
+		published    int
+		lastID       uint64
+		wantIDs      []uint64
+		wantComplete bool
+	}{
+		{name: "No last ID", historySize: 5, published: 3, lastID: 0, wantIDs: nil, wantComplete: true},
+		{name: "Up to date", historySize: 5, published: 3, lastID: 3, wantIDs: nil, wantComplete: true},
+		{name: "Resume inside history", historySize: 5, published: 3, lastID: 1, wantIDs: []uint64{2, 3}, wantComplete: true},
+		{name: "Resume after wrap", historySize: 3, published: 5, lastID: 2, wantIDs: []uint64{3, 4, 5}, wantComplete: true},
+		{name: "Gap in history", historySize: 3, published: 6, lastID: 1, wantIDs: []uint64{4, 5, 6}, wantComplete: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBroker(tt.historySize)
+			for i := 0; i < tt.published; i++ {
+				b.Publish(Event{Type: "chirp.created"})
+			}
+
+			sub, missed, complete := b.SubscribeSince(tt.lastID, nil, 10)
+			defer sub.Unsubscribe()
+
+			if complete != tt.wantComplete {
+				t.Errorf("complete = %v, want %v", complete, tt.wantComplete)
+			}
+			if len(missed) != len(tt.wantIDs) {
+				t.Fatalf("got %d missed events, want %d", len(missed), len(tt.wantIDs))
+			}
+			for i, e := range missed {
+				if e.ID != tt.wantIDs[i] {
+					t.Errorf("missed[%d].ID = %d, want %d", i, e.ID, tt.wantIDs[i])
+				}
+			}
+
+			b.Publish(Event{Type: "chirp.created"})
+			if e := <-sub.C; e.ID != uint64(tt.published+1) {
+				t.Errorf("live event ID = %d, want %d", e.ID, tt.published+1)
+			}
+		})
+	}
+}
+
+func TestPublishKeepsExistingIDs(t *testing.T) {
+	b := NewBroker(10)
+
+	relayed := b.Publish(Event{ID: 41, Type: "chirp.created"})
+	if relayed.ID != 41 {
+		t.Errorf("relayed event ID = %d, want 41", relayed.ID)
+	}
+
+	local := b.Publish(Event{Type: "chirp.created"})
+	if local.ID != 42 {
+		t.Errorf("local event ID = %d, want 42", local.ID)
+	}
+
+	// An older relayed event doesn't move the last ID backwards.
+	b.Publish(Event{ID: 40, Type: "chirp.created"})
+	sub, missed, complete := b.SubscribeSince(39, nil, 10)
+	defer sub.Unsubscribe()
+
+	if !complete {
+		t.Error("expected history from 40 onwards to be complete")
+	}
+	if len(missed) != 3 {
+		t.Errorf("got %d missed events, want 3", len(missed))
+	}
+}
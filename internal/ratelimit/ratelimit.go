@@ -0,0 +1,134 @@
+// Package ratelimit implements token bucket rate limiting. Each key gets a
+// bucket holding up to Policy.Limit tokens that refills completely over
+// Policy.Period, and every request takes one token.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+type Policy struct {
+	// Name keeps the buckets of different policies apart when they are
+	// keyed on the same user or IP.
+	Name   string
+	Limit  int
+	Period time.Duration
+}
+
+// RefillRate is the number of tokens added to a bucket per second.
+func (p Policy) RefillRate() float64 {
+	return float64(p.Limit) / p.Period.Seconds()
+}
+
+// Header is the value of the RateLimit-Policy header, e.g. "10;w=60".
+func (p Policy) Header() string {
+	return fmt.Sprintf("%d;w=%d", p.Limit, int(p.Period.Seconds()))
+}
+
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is how long until the next request would be allowed. It is
+	// zero when this request was allowed.
+	RetryAfter time.Duration
+}
+
+// ResultFor works out the Result from the tokens left in a bucket after a
+// request.
+func ResultFor(p Policy, tokens float64, allowed bool) Result {
+	rate := p.RefillRate()
+
+	result := Result{
+		Allowed:   allowed,
+		Limit:     p.Limit,
+		Remaining: int(math.Floor(max(tokens, 0))),
+		Reset:     time.Duration((float64(p.Limit) - tokens) / rate * float64(time.Second)),
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration((1 - tokens) / rate * float64(time.Second))
+	}
+	return result
+}
+
+type Bucket struct {
+	Tokens    float64
+	UpdatedAt time.Time
+}
+
+// Take refills the bucket for the time since it was last used and takes a
+// token from it if there is one. A zero Bucket is treated as full.
+func (b Bucket) Take(p Policy, now time.Time) (Bucket, Result) {
+	tokens := float64(p.Limit)
+	if !b.UpdatedAt.IsZero() {
+		elapsed := max(now.Sub(b.UpdatedAt).Seconds(), 0)
+		tokens = min(float64(p.Limit), b.Tokens+elapsed*p.RefillRate())
+	}
+
+	allowed := tokens >= 1
+	if allowed {
+		tokens--
+	}
+
+	return Bucket{Tokens: tokens, UpdatedAt: now}, ResultFor(p, tokens, allowed)
+}
+
+// Store keeps the buckets. MemoryStore is enough for a single server; when
+// several servers share the load they need a shared store so a client can't
+// get the limit once per server.
+type Store interface {
+	Take(ctx context.Context, key string, p Policy) (Result, error)
+}
+
+type memoryEntry struct {
+	bucket Bucket
+	period time.Duration
+}
+
+type MemoryStore struct {
+	Now func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]memoryEntry
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		Now:     time.Now,
+		buckets: map[string]memoryEntry{},
+	}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, p Policy) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.Now()
+	s.sweep(now)
+
+	bucket, result := s.buckets[key].bucket.Take(p, now)
+	s.buckets[key] = memoryEntry{bucket: bucket, period: p.Period}
+	return result, nil
+}
+
+// sweep drops buckets that have had time to refill completely, since they
+// are no different from a missing one. It runs at most once a minute.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+
+	for key, e := range s.buckets {
+		if now.Sub(e.bucket.UpdatedAt) >= e.period {
+			delete(s.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBucketTake(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	policy := Policy{Name: "test", Limit: 10, Period: time.Minute}
+
+	tests := []struct {
+		name          string
+		bucket        Bucket
+		now           time.Time
+		wantAllowed   bool
+		wantRemaining int
+		wantRetry     time.Duration
+	}{
+		{
+			name:          "New bucket starts full",
+			bucket:        Bucket{},
+			now:           now,
+			wantAllowed:   true,
+			wantRemaining: 9,
+		},
+		{
+			name:          "Empty bucket is rejected",
+			bucket:        Bucket{Tokens: 0, UpdatedAt: now},
+			now:           now,
+			wantAllowed:   false,
+			wantRemaining: 0,
+			wantRetry:     6 * time.Second,
+		},
+		{
+			name:          "Bucket refills over time",
+			bucket:        Bucket{Tokens: 0, UpdatedAt: now},
+			now:           now.Add(12 * time.Second),
+			wantAllowed:   true,
+			wantRemaining: 1,
+		},
+		{
+			name:          "Refill is capped at the limit",
+			bucket:        Bucket{Tokens: 5, UpdatedAt: now},
+			now:           now.Add(time.Hour),
+			wantAllowed:   true,
+			wantRemaining: 9,
+		},
+		{
+			name:          "Partly refilled bucket waits for the rest of the token",
+			bucket:        Bucket{Tokens: 0.5, UpdatedAt: now},
+			now:           now,
+			wantAllowed:   false,
+			wantRemaining: 0,
+			wantRetry:     3 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, result := tt.bucket.Take(policy, tt.now)
+			if result.Allowed != tt.wantAllowed {
+				t.Errorf("Allowed = %v, want %v", result.Allowed, tt.wantAllowed)
+			}
+			if result.Remaining != tt.wantRemaining {
+				t.Errorf("Remaining = %d, want %d", result.Remaining, tt.wantRemaining)
+			}
+			if result.RetryAfter != tt.wantRetry {
+				t.Errorf("RetryAfter = %s, want %s", result.RetryAfter, tt.wantRetry)
+			}
+		})
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.Now = func() time.Time { return now }
+
+	policy := Policy{Name: "test", Limit: 3, Period: 3 * time.Second}
+
+	for i := range 3 {
+		result, _ := store.Take(context.Background(), "a", policy)
+		if !result.Allowed {
+			t.Fatalf("request %d was rejected, want allowed", i+1)
+		}
+	}
+
+	result, _ := store.Take(context.Background(), "a", policy)
+	if result.Allowed {
+		t.Error("fourth request was allowed, want rejected")
+	}
+
+	result, _ = store.Take(context.Background(), "b", policy)
+	if !result.Allowed {
+		t.Error("a different key was rejected, want allowed")
+	}
+
+	now = now.Add(time.Second)
+	result, _ = store.Take(context.Background(), "a", policy)
+	if !result.Allowed {
+		t.Error("request after refill was rejected, want allowed")
+	}
+
+	now = now.Add(time.Hour)
+	store.Take(context.Background(), "c", policy)
+	if len(store.buckets) != 1 {
+		t.Errorf("got %d buckets after sweep, want 1", len(store.buckets))
+	}
+}
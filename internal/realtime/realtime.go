@@ -0,0 +1,406 @@
+// Package realtime serves the WebSocket API. Each connection subscribes to
+// topics on a pubsub.Broker and is sent the events published to them.
+//
+// Clients send JSON messages of the form
+//
+//	{"type": "subscribe", "topic": "user:<id>"}
+//	{"type": "unsubscribe", "topic": "user:<id>"}
+//
+// and are sent "subscribed", "unsubscribed", "event" and "error" messages
+// back.
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/sam-maton/chirpy/internal/pubsub"
+)
+
+const (
+	TopicTimeline            = "timeline"
+	TopicUserPrefix          = "user:"
+	TopicTagPrefix           = "tag:"
+	TopicNotificationsPrefix = "notifications:"
+
+	maxMessageBytes = 4096
+	maxTopics       = 50
+)
+
+var (
+	ErrInvalidTopic   = errors.New("invalid topic")
+	ErrForbiddenTopic = errors.New("topic belongs to another user")
+	ErrHiddenTopic    = errors.New("user is blocked or muted")
+	ErrTooManyTopics  = errors.New("too many subscriptions")
+)
+
+var tagPattern = regexp.MustCompile(`^[a-z0-9_]{1,50}$`)
+
+// ValidateTopic checks a topic is well formed and that userId may subscribe
+// to it. Notifications can only be read by the user they are for.
+func ValidateTopic(topic string, userId uuid.UUID) error {
+	switch {
+	case topic == TopicTimeline:
+		return nil
+	case strings.HasPrefix(topic, TopicUserPrefix):
+		_, err := uuid.Parse(strings.TrimPrefix(topic, TopicUserPrefix))
+		if err != nil {
+			return ErrInvalidTopic
+		}
+		return nil
+	case strings.HasPrefix(topic, TopicTagPrefix):
+		if !tagPattern.MatchString(strings.TrimPrefix(topic, TopicTagPrefix)) {
+			return ErrInvalidTopic
+		}
+		return nil
+	case strings.HasPrefix(topic, TopicNotificationsPrefix):
+		id, err := uuid.Parse(strings.TrimPrefix(topic, TopicNotificationsPrefix))
+		if err != nil {
+			return ErrInvalidTopic
+		}
+		if id != userId {
+			return ErrForbiddenTopic
+		}
+		return nil
+	}
+	return ErrInvalidTopic
+}
+
+type clientMessage struct {
+	Type  string `json:"type"`
+	Topic string `json:"topic"`
+}
+
+type serverMessage struct {
+	Type    string          `json:"type"`
+	ID      uint64          `json:"id,omitempty"`
+	Event   string          `json:"event,omitempty"`
+	Topic   string          `json:"topic,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Message string          `json:"message,omitempty"`
+}
+
+type Server struct {
+	Broker *pubsub.Broker
+	// HiddenAuthors returns the users whose events a user mustn't be sent,
+	// such as anyone they have blocked. Nobody is hidden if it is nil.
+	HiddenAuthors func(ctx context.Context, userId uuid.UUID) ([]uuid.UUID, error)
+	// MaxConnsPerUser limits how many sockets one user can hold open.
+	MaxConnsPerUser int
+	// SendBuffer is how many events can be waiting for a connection before
+	// it is treated as too slow and closed.
+	SendBuffer   int
+	PingInterval time.Duration
+	WriteTimeout time.Duration
+
+	mu    sync.Mutex
+	conns map[uuid.UUID]int
+	open  map[uuid.UUID]map[*connection]struct{}
+}
+
+func NewServer(broker *pubsub.Broker, maxConnsPerUser int) *Server {
+	return &Server{
+		Broker:          broker,
+		MaxConnsPerUser: maxConnsPerUser,
+		SendBuffer:      64,
+		PingInterval:    30 * time.Second,
+		WriteTimeout:    10 * time.Second,
+		conns:           map[uuid.UUID]int{},
+		open:            map[uuid.UUID]map[*connection]struct{}{},
+	}
+}
+
+// Acquire reserves a connection slot for the user. It must be called before
+// upgrading the request so a user over the limit gets a normal HTTP error,
+// and every successful call must be matched by a Release.
+func (s *Server) Acquire(userId uuid.UUID) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conns[userId] >= s.MaxConnsPerUser {
+		return false
+	}
+	s.conns[userId]++
+	return true
+}
+
+func (s *Server) Release(userId uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.conns[userId]--
+	if s.conns[userId] <= 0 {
+		delete(s.conns, userId)
+	}
+}
+
+// Disconnect closes every connection the user has open on this server, such
+// as when their account is suspended. reason is sent to the client.
+func (s *Server) Disconnect(userId uuid.UUID, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for c := range s.open[userId] {
+		// Each connection only needs telling once.
+		select {
+		case c.kick <- reason:
+		default:
+		}
+	}
+}
+
+// RefreshHidden reloads the hidden authors of the user's open connections.
+// It should be called whenever the user blocks, mutes or is blocked by
+// someone.
+func (s *Server) RefreshHidden(ctx context.Context, userId uuid.UUID) error {
+	s.mu.Lock()
+	conns := []*connection{}
+	for c := range s.open[userId] {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+
+	if len(conns) == 0 {
+		return nil
+	}
+
+	hidden, err := s.hiddenTopics(ctx, userId)
+	if err != nil {
+		return err
+	}
+	for _, c := range conns {
+		c.mu.Lock()
+		c.hidden = hidden
+		c.mu.Unlock()
+	}
+	return nil
+}
+
+// hiddenTopics returns the user topics of the user's hidden authors. Their
+// chirp events are always published to those topics, so matching on them is
+// enough to drop the events whatever else they were published to.
+func (s *Server) hiddenTopics(ctx context.Context, userId uuid.UUID) (map[string]struct{}, error) {
+	hidden := map[string]struct{}{}
+	if s.HiddenAuthors == nil {
+		return hidden, nil
+	}
+
+	authors, err := s.HiddenAuthors(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range authors {
+		hidden[TopicUserPrefix+id.String()] = struct{}{}
+	}
+	return hidden, nil
+}
+
+func (s *Server) track(c *connection) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.open[c.userId] == nil {
+		s.open[c.userId] = map[*connection]struct{}{}
+	}
+	s.open[c.userId][c] = struct{}{}
+}
+
+func (s *Server) untrack(c *connection) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.open[c.userId], c)
+	if len(s.open[c.userId]) == 0 {
+		delete(s.open, c.userId)
+	}
+}
+
+type connection struct {
+	userId uuid.UUID
+
+	// kick is sent the reason when the connection has to be closed from
+	// outside, so that Serve stays the only goroutine writing to the socket.
+	kick chan string
+
+	mu     sync.Mutex
+	topics map[string]struct{}
+	hidden map[string]struct{}
+}
+
+func (c *connection) matches(e pubsub.Event) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, t := range e.Topics {
+		if _, ok := c.hidden[t]; ok {
+			return false
+		}
+	}
+	for _, t := range e.Topics {
+		if _, ok := c.topics[t]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Serve runs the connection until the client goes away, stops answering
+// pings, falls too far behind, is disconnected or reaches expiresAt, when
+// the token it was opened with runs out. It closes conn before returning.
+func (s *Server) Serve(conn *websocket.Conn, userId uuid.UUID, expiresAt time.Time) {
+	defer conn.Close()
+
+	c := &connection{userId: userId, kick: make(chan string, 1), topics: map[string]struct{}{}}
+	s.track(c)
+	defer s.untrack(c)
+
+	hidden, err := s.hiddenTopics(context.Background(), userId)
+	if err != nil {
+		s.closeWith(conn, websocket.CloseInternalServerErr, "could not load blocked users")
+		return
+	}
+	c.mu.Lock()
+	c.hidden = hidden
+	c.mu.Unlock()
+
+	sub := s.Broker.Subscribe(c.matches, s.SendBuffer)
+	defer sub.Unsubscribe()
+
+	// Replies to client messages go through the writer so that only one
+	// goroutine ever writes to the socket.
+	replies := make(chan serverMessage, 16)
+	readerDone := make(chan struct{})
+	go func() {
+		defer close(readerDone)
+		s.read(conn, c, replies)
+	}()
+
+	ping := time.NewTicker(s.PingInterval)
+	defer ping.Stop()
+
+	expired := time.NewTimer(time.Until(expiresAt))
+	defer expired.Stop()
+
+	for {
+		var msg serverMessage
+		select {
+		case <-readerDone:
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				s.closeWith(conn, websocket.CloseTryAgainLater, "too slow to keep up with events")
+				return
+			}
+			msg = serverMessage{Type: "event", ID: e.ID, Event: e.Type, Data: e.Data}
+		case msg = <-replies:
+		case reason := <-c.kick:
+			s.closeWith(conn, websocket.ClosePolicyViolation, reason)
+			return
+		case <-expired.C:
+			s.closeWith(conn, websocket.ClosePolicyViolation, "auth token expired")
+			return
+		case <-ping.C:
+			err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(s.WriteTimeout))
+			if err != nil {
+				return
+			}
+			continue
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(s.WriteTimeout))
+		if err := conn.WriteJSON(msg); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) read(conn *websocket.Conn, c *connection, replies chan<- serverMessage) {
+	// Pings are sent every PingInterval, so a client that hasn't said
+	// anything, not even a pong, for two intervals is gone.
+	readTimeout := 2 * s.PingInterval
+	conn.SetReadLimit(maxMessageBytes)
+	conn.SetReadDeadline(time.Now().Add(readTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(readTimeout))
+	})
+
+	for {
+		msg := clientMessage{}
+		err := conn.ReadJSON(&msg)
+		if err != nil {
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				if !reply(replies, serverMessage{Type: "error", Message: "messages must be JSON"}) {
+					return
+				}
+				continue
+			}
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(readTimeout))
+
+		var response serverMessage
+		switch msg.Type {
+		case "subscribe":
+			response = c.subscribe(msg.Topic)
+		case "unsubscribe":
+			c.mu.Lock()
+			delete(c.topics, msg.Topic)
+			c.mu.Unlock()
+			response = serverMessage{Type: "unsubscribed", Topic: msg.Topic}
+		case "ping":
+			response = serverMessage{Type: "pong"}
+		default:
+			response = serverMessage{Type: "error", Message: "unknown message type"}
+		}
+
+		// A client that sends faster than it reads its replies is cut off
+		// rather than buffered without limit.
+		if !reply(replies, response) {
+			return
+		}
+	}
+}
+
+func (c *connection) subscribe(topic string) serverMessage {
+	err := ValidateTopic(topic, c.userId)
+	if err != nil {
+		return serverMessage{Type: "error", Topic: topic, Message: err.Error()}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.hidden[topic]; ok {
+		return serverMessage{Type: "error", Topic: topic, Message: ErrHiddenTopic.Error()}
+	}
+	if _, ok := c.topics[topic]; !ok && len(c.topics) >= maxTopics {
+		return serverMessage{Type: "error", Topic: topic, Message: ErrTooManyTopics.Error()}
+	}
+	c.topics[topic] = struct{}{}
+	return serverMessage{Type: "subscribed", Topic: topic}
+}
+
+func reply(replies chan<- serverMessage, msg serverMessage) bool {
+	select {
+	case replies <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Server) closeWith(conn *websocket.Conn, code int, text string) {
+	conn.WriteControl(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(code, text),
+		time.Now().Add(s.WriteTimeout),
+	)
+}
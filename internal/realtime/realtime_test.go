@@ -0,0 +1,231 @@
+package realtime
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/sam-maton/chirpy/internal/pubsub"
+)
+
+func newTestServer(t *testing.T, s *Server, userId uuid.UUID) *websocket.Conn {
+	t.Helper()
+	return newTestServerUntil(t, s, userId, time.Now().Add(time.Hour))
+}
+
+// newTestServerUntil is newTestServer for a token that expires at expiresAt.
+func newTestServerUntil(t *testing.T, s *Server, userId uuid.UUID, expiresAt time.Time) *websocket.Conn {
+	t.Helper()
+
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		s.Serve(conn, userId, expiresAt)
+	}))
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("could not connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+func TestSubscribeAndReceive(t *testing.T) {
+	broker := pubsub.NewBroker(10)
+	userId := uuid.New()
+	conn := newTestServer(t, NewServer(broker, 5), userId)
+
+	conn.WriteJSON(clientMessage{Type: "subscribe", Topic: "tag:golang"})
+	reply := serverMessage{}
+	if err := conn.ReadJSON(&reply); err != nil {
+		t.Fatalf("reading reply: %v", err)
+	}
+	if reply.Type != "subscribed" || reply.Topic != "tag:golang" {
+		t.Fatalf("unexpected reply: %+v", reply)
+	}
+
+	broker.Publish(pubsub.Event{Type: "chirp.created", Topics: []string{"timeline"}, Data: []byte(`{"n":1}`)})
+	broker.Publish(pubsub.Event{Type: "chirp.created", Topics: []string{"timeline", "tag:golang"}, Data: []byte(`{"n":2}`)})
+
+	event := serverMessage{}
+	if err := conn.ReadJSON(&event); err != nil {
+		t.Fatalf("reading event: %v", err)
+	}
+	if event.Type != "event" || event.Event != "chirp.created" || string(event.Data) != `{"n":2}` {
+		t.Errorf("unexpected event: %+v", event)
+	}
+}
+
+func TestSubscribeRejectsOtherUsersNotifications(t *testing.T) {
+	conn := newTestServer(t, NewServer(pubsub.NewBroker(10), 5), uuid.New())
+
+	conn.WriteJSON(clientMessage{Type: "subscribe", Topic: "notifications:" + uuid.NewString()})
+	reply := serverMessage{}
+	if err := conn.ReadJSON(&reply); err != nil {
+		t.Fatalf("reading reply: %v", err)
+	}
+	if reply.Type != "error" {
+		t.Errorf("expected an error, got %+v", reply)
+	}
+}
+
+func TestHiddenAuthorsAreFiltered(t *testing.T) {
+	broker := pubsub.NewBroker(10)
+	blocked := uuid.New()
+	s := NewServer(broker, 5)
+	s.HiddenAuthors = func(ctx context.Context, userId uuid.UUID) ([]uuid.UUID, error) {
+		return []uuid.UUID{blocked}, nil
+	}
+	conn := newTestServer(t, s, uuid.New())
+
+	conn.WriteJSON(clientMessage{Type: "subscribe", Topic: "user:" + blocked.String()})
+	reply := serverMessage{}
+	if err := conn.ReadJSON(&reply); err != nil {
+		t.Fatalf("reading reply: %v", err)
+	}
+	if reply.Type != "error" {
+		t.Errorf("expected an error subscribing to a hidden user, got %+v", reply)
+	}
+
+	conn.WriteJSON(clientMessage{Type: "subscribe", Topic: "timeline"})
+	if err := conn.ReadJSON(&reply); err != nil || reply.Type != "subscribed" {
+		t.Fatalf("unexpected reply: %+v, %v", reply, err)
+	}
+
+	broker.Publish(pubsub.Event{Type: "chirp.created", Topics: []string{"timeline", "user:" + blocked.String()}, Data: []byte(`{"n":1}`)})
+	broker.Publish(pubsub.Event{Type: "chirp.created", Topics: []string{"timeline", "user:" + uuid.NewString()}, Data: []byte(`{"n":2}`)})
+
+	event := serverMessage{}
+	if err := conn.ReadJSON(&event); err != nil {
+		t.Fatalf("reading event: %v", err)
+	}
+	if string(event.Data) != `{"n":2}` {
+		t.Errorf("got the hidden author's event: %+v", event)
+	}
+}
+
+func TestSlowConsumerIsClosed(t *testing.T) {
+	broker := pubsub.NewBroker(10)
+	s := NewServer(broker, 5)
+	s.SendBuffer = 1
+	userId := uuid.New()
+	conn := newTestServer(t, s, userId)
+
+	conn.WriteJSON(clientMessage{Type: "subscribe", Topic: "timeline"})
+	conn.ReadJSON(&serverMessage{})
+
+	// Publishing is faster than the socket can be written to, so the small
+	// buffer overflows and the connection is dropped.
+	for i := 0; i < 1000; i++ {
+		broker.Publish(pubsub.Event{Type: "chirp.created", Topics: []string{"timeline"}, Data: []byte(`{}`)})
+	}
+
+	for {
+		err := conn.ReadJSON(&serverMessage{})
+		if err == nil {
+			continue
+		}
+		if !websocket.IsCloseError(err, websocket.CloseTryAgainLater) {
+			t.Errorf("expected a try again later close, got %v", err)
+		}
+		return
+	}
+}
+
+func TestAcquireLimitsConnections(t *testing.T) {
+	s := NewServer(pubsub.NewBroker(10), 2)
+	userId := uuid.New()
+
+	if !s.Acquire(userId) || !s.Acquire(userId) {
+		t.Fatal("expected the first two connections to be allowed")
+	}
+	if s.Acquire(userId) {
+		t.Fatal("expected the third connection to be refused")
+	}
+	if !s.Acquire(uuid.New()) {
+		t.Fatal("expected another user to be allowed")
+	}
+
+	s.Release(userId)
+	if !s.Acquire(userId) {
+		t.Fatal("expected a connection to be allowed after a release")
+	}
+}
+
+func TestValidateTopic(t *testing.T) {
+	userId := uuid.New()
+
+	tests := []struct {
+		topic   string
+		wantErr error
+	}{
+		{topic: "timeline", wantErr: nil},
+		{topic: "user:" + uuid.NewString(), wantErr: nil},
+		{topic: "user:bob", wantErr: ErrInvalidTopic},
+		{topic: "tag:go_lang", wantErr: nil},
+		{topic: "tag:Go Lang", wantErr: ErrInvalidTopic},
+		{topic: "notifications:" + userId.String(), wantErr: nil},
+		{topic: "notifications:" + uuid.NewString(), wantErr: ErrForbiddenTopic},
+		{topic: "everything", wantErr: ErrInvalidTopic},
+	}
+	for _, tt := range tests {
+		t.Run(tt.topic, func(t *testing.T) {
+			err := ValidateTopic(tt.topic, userId)
+			if err != tt.wantErr {
+				t.Errorf("ValidateTopic(%q) = %v, want %v", tt.topic, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConnectionIsClosed(t *testing.T) {
+	tests := []struct {
+		name       string
+		expiresIn  time.Duration
+		disconnect bool
+		wantReason string
+	}{
+		{name: "Disconnected", expiresIn: time.Hour, disconnect: true, wantReason: "account suspended"},
+		{name: "Token expired", expiresIn: 200 * time.Millisecond, wantReason: "auth token expired"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer(pubsub.NewBroker(10), 5)
+			userId := uuid.New()
+			conn := newTestServerUntil(t, s, userId, time.Now().Add(tt.expiresIn))
+
+			// The reply means the connection is being served.
+			conn.WriteJSON(clientMessage{Type: "ping"})
+			reply := serverMessage{}
+			if err := conn.ReadJSON(&reply); err != nil {
+				t.Fatalf("reading reply: %v", err)
+			}
+
+			if tt.disconnect {
+				s.Disconnect(userId, tt.wantReason)
+			}
+
+			_, _, err := conn.ReadMessage()
+			closeErr := &websocket.CloseError{}
+			if !errors.As(err, &closeErr) {
+				t.Fatalf("expected the connection to be closed, got %v", err)
+			}
+			if closeErr.Code != websocket.ClosePolicyViolation || closeErr.Text != tt.wantReason {
+				t.Errorf("closed with %d %q, want %d %q", closeErr.Code, closeErr.Text, websocket.ClosePolicyViolation, tt.wantReason)
+			}
+		})
+	}
+}
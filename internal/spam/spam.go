@@ -0,0 +1,240 @@
+// Package spam scores new chirps for how likely they are to be spam. A
+// Pipeline runs a set of Classifiers over a chirp, adds up their scores and
+// turns the total into a Verdict.
+package spam
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+type Verdict int
+
+// Verdicts are ordered by severity.
+const (
+	// Allow posts the chirp as normal.
+	Allow Verdict = iota
+	// Flag posts the chirp and reports it to the moderators.
+	Flag
+	// ShadowHide posts the chirp but only shows it to its author, and
+	// reports it to the moderators.
+	ShadowHide
+	// Reject refuses to post the chirp.
+	Reject
+)
+
+func (v Verdict) String() string {
+	switch v {
+	case Allow:
+		return "allow"
+	case Flag:
+		return "flag"
+	case ShadowHide:
+		return "shadow_hide"
+	case Reject:
+		return "reject"
+	}
+	return fmt.Sprintf("Verdict(%d)", int(v))
+}
+
+// Input is everything a Classifier gets to look at.
+type Input struct {
+	Body            string
+	AuthorCreatedAt time.Time
+	// RecentBodies holds the author's chirps from within the pipeline's
+	// window, newest first.
+	RecentBodies []string
+	Now          time.Time
+	// Editing is set when Body is the new text of a chirp that was already
+	// posted rather than a new chirp.
+	Editing bool
+}
+
+// Signal is one Classifier's opinion of a chirp. A Score of 1 or more is
+// enough to reject a chirp on its own.
+type Signal struct {
+	Score  float64
+	Reason string
+}
+
+type Classifier interface {
+	Classify(ctx context.Context, in Input) (Signal, error)
+}
+
+// ClassifierFunc lets a plain function be used as a Classifier.
+type ClassifierFunc func(ctx context.Context, in Input) (Signal, error)
+
+func (f ClassifierFunc) Classify(ctx context.Context, in Input) (Signal, error) {
+	return f(ctx, in)
+}
+
+type Decision struct {
+	Verdict Verdict
+	Score   float64
+	Reasons []string
+}
+
+type Pipeline struct {
+	Classifiers []Classifier
+	// Window is how far back Input.RecentBodies should go.
+	Window time.Duration
+
+	FlagScore       float64
+	ShadowHideScore float64
+	RejectScore     float64
+}
+
+// DefaultPipeline runs the built in heuristics.
+func DefaultPipeline() *Pipeline {
+	return &Pipeline{
+		Classifiers: []Classifier{
+			Duplicate{},
+			LinkDensity{MaxLinks: 2},
+			Repetition{},
+			NewAccount{MinAge: 24 * time.Hour, MaxChirps: 5},
+		},
+		Window:          time.Hour,
+		FlagScore:       0.5,
+		ShadowHideScore: 0.8,
+		RejectScore:     1,
+	}
+}
+
+// Evaluate runs every classifier over the chirp. An error from any of them
+// stops the pipeline, and the caller decides whether to fail open.
+func (p *Pipeline) Evaluate(ctx context.Context, in Input) (Decision, error) {
+	decision := Decision{Verdict: Allow}
+
+	for _, c := range p.Classifiers {
+		signal, err := c.Classify(ctx, in)
+		if err != nil {
+			return Decision{}, err
+		}
+		if signal.Score <= 0 {
+			continue
+		}
+
+		decision.Score += signal.Score
+		if signal.Reason != "" {
+			decision.Reasons = append(decision.Reasons, signal.Reason)
+		}
+	}
+
+	switch {
+	case decision.Score >= p.RejectScore:
+		decision.Verdict = Reject
+	case decision.Score >= p.ShadowHideScore:
+		decision.Verdict = ShadowHide
+	case decision.Score >= p.FlagScore:
+		decision.Verdict = Flag
+	}
+
+	return decision, nil
+}
+
+// normalize makes small changes to a chirp, like case and spacing, not
+// enough to get past the duplicate check.
+func normalize(body string) string {
+	return strings.Join(strings.Fields(strings.ToLower(body)), " ")
+}
+
+// Duplicate rejects a chirp that is the same as one the author posted within
+// the window.
+type Duplicate struct{}
+
+func (Duplicate) Classify(ctx context.Context, in Input) (Signal, error) {
+	body := normalize(in.Body)
+	for _, recent := range in.RecentBodies {
+		if normalize(recent) == body {
+			return Signal{Score: 1, Reason: "duplicate of a recent chirp"}, nil
+		}
+	}
+	return Signal{}, nil
+}
+
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+`)
+
+// LinkDensity scores chirps with too many links, or that are mostly links.
+type LinkDensity struct {
+	MaxLinks int
+}
+
+func (l LinkDensity) Classify(ctx context.Context, in Input) (Signal, error) {
+	links := linkPattern.FindAllString(in.Body, -1)
+	if len(links) == 0 {
+		return Signal{}, nil
+	}
+
+	if len(links) > l.MaxLinks {
+		return Signal{Score: 0.6, Reason: "too many links"}, nil
+	}
+
+	linkChars := 0
+	for _, link := range links {
+		linkChars += len(link)
+	}
+	text := len(strings.TrimSpace(in.Body))
+	if text > 0 && float64(linkChars)/float64(text) > 0.8 {
+		return Signal{Score: 0.3, Reason: "mostly links"}, nil
+	}
+
+	return Signal{}, nil
+}
+
+// Repetition scores chirps that repeat one character or one word over and
+// over.
+type Repetition struct{}
+
+func (Repetition) Classify(ctx context.Context, in Input) (Signal, error) {
+	run := 0
+	var last rune
+	for _, r := range in.Body {
+		if r == last && !unicode.IsSpace(r) {
+			run++
+		} else {
+			run = 1
+		}
+		last = r
+
+		if run >= 10 {
+			return Signal{Score: 0.5, Reason: "repeated characters"}, nil
+		}
+	}
+
+	words := strings.Fields(strings.ToLower(in.Body))
+	if len(words) < 6 {
+		return Signal{}, nil
+	}
+
+	counts := map[string]int{}
+	for _, word := range words {
+		counts[word]++
+		if counts[word]*2 > len(words) {
+			return Signal{Score: 0.5, Reason: "repeated words"}, nil
+		}
+	}
+
+	return Signal{}, nil
+}
+
+// NewAccount limits how many chirps an account can post within the window
+// until it is MinAge old. Edits don't post anything, so they aren't limited.
+type NewAccount struct {
+	MinAge    time.Duration
+	MaxChirps int
+}
+
+func (n NewAccount) Classify(ctx context.Context, in Input) (Signal, error) {
+	if in.Editing || in.Now.Sub(in.AuthorCreatedAt) >= n.MinAge {
+		return Signal{}, nil
+	}
+
+	if len(in.RecentBodies) >= n.MaxChirps {
+		return Signal{Score: 1, Reason: "new accounts can't post that many chirps yet"}, nil
+	}
+	return Signal{}, nil
+}
@@ -0,0 +1,148 @@
+package spam
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPipelineEvaluate(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	oldAccount := now.Add(-30 * 24 * time.Hour)
+
+	tests := []struct {
+		name        string
+		input       Input
+		wantVerdict Verdict
+	}{
+		{
+			name: "Ordinary chirp is allowed",
+			input: Input{
+				Body:            "Just had the best coffee in town",
+				AuthorCreatedAt: oldAccount,
+				Now:             now,
+			},
+			wantVerdict: Allow,
+		},
+		{
+			name: "Duplicate is rejected",
+			input: Input{
+				Body:            "Buy   my course NOW",
+				AuthorCreatedAt: oldAccount,
+				RecentBodies:    []string{"something else", "buy my course now"},
+				Now:             now,
+			},
+			wantVerdict: Reject,
+		},
+		{
+			name: "Too many links is flagged",
+			input: Input{
+				Body:            "see https://a.example and https://b.example and www.c.example",
+				AuthorCreatedAt: oldAccount,
+				Now:             now,
+			},
+			wantVerdict: Flag,
+		},
+		{
+			name: "Links and repetition together are rejected",
+			input: Input{
+				Body:            "free free free free free free https://a.example https://b.example https://c.example",
+				AuthorCreatedAt: oldAccount,
+				Now:             now,
+			},
+			wantVerdict: Reject,
+		},
+		{
+			name: "Bare link full of repeated characters is shadow hidden",
+			input: Input{
+				Body:            "https://aaaaaaaaaaaaaaaaaa.example",
+				AuthorCreatedAt: oldAccount,
+				Now:             now,
+			},
+			wantVerdict: ShadowHide,
+		},
+		{
+			name: "Repeated characters are flagged",
+			input: Input{
+				Body:            "wowwwwwwwwwwwww",
+				AuthorCreatedAt: oldAccount,
+				Now:             now,
+			},
+			wantVerdict: Flag,
+		},
+		{
+			name: "New account over its limit is rejected",
+			input: Input{
+				Body:            "hello again",
+				AuthorCreatedAt: now.Add(-time.Hour),
+				RecentBodies:    []string{"1", "2", "3", "4", "5"},
+				Now:             now,
+			},
+			wantVerdict: Reject,
+		},
+		{
+			name: "New account under its limit is allowed",
+			input: Input{
+				Body:            "hello again",
+				AuthorCreatedAt: now.Add(-time.Hour),
+				RecentBodies:    []string{"1", "2"},
+				Now:             now,
+			},
+			wantVerdict: Allow,
+		},
+		{
+			name: "New account over its limit can still edit",
+			input: Input{
+				Body:            "hello again",
+				AuthorCreatedAt: now.Add(-time.Hour),
+				RecentBodies:    []string{"1", "2", "3", "4", "5"},
+				Now:             now,
+				Editing:         true,
+			},
+			wantVerdict: Allow,
+		},
+	}
+
+	pipeline := DefaultPipeline()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := pipeline.Evaluate(context.Background(), tt.input)
+			if err != nil {
+				t.Fatalf("Evaluate() error = %v", err)
+			}
+			if decision.Verdict != tt.wantVerdict {
+				t.Errorf("Verdict = %s (score %.2f, %v), want %s", decision.Verdict, decision.Score, decision.Reasons, tt.wantVerdict)
+			}
+		})
+	}
+}
+
+func TestPipelineCustomClassifier(t *testing.T) {
+	pipeline := DefaultPipeline()
+	pipeline.Classifiers = append(pipeline.Classifiers, ClassifierFunc(func(ctx context.Context, in Input) (Signal, error) {
+		if strings.Contains(in.Body, "crypto") {
+			return Signal{Score: 0.8, Reason: "mentions crypto"}, nil
+		}
+		return Signal{}, nil
+	}))
+
+	decision, err := pipeline.Evaluate(context.Background(), Input{Body: "crypto giveaway", Now: time.Now()})
+	if err != nil {
+		t.Fatalf("Evaluate() error = %v", err)
+	}
+	if decision.Verdict != ShadowHide || len(decision.Reasons) != 1 || decision.Reasons[0] != "mentions crypto" {
+		t.Errorf("got %s %v, want shadow_hide [mentions crypto]", decision.Verdict, decision.Reasons)
+	}
+
+	failing := errors.New("classifier unavailable")
+	pipeline.Classifiers = append(pipeline.Classifiers, ClassifierFunc(func(ctx context.Context, in Input) (Signal, error) {
+		return Signal{}, failing
+	}))
+	_, err = pipeline.Evaluate(context.Background(), Input{Body: "hi", Now: time.Now()})
+	if !errors.Is(err, failing) {
+		t.Errorf("Evaluate() error = %v, want %v", err, failing)
+	}
+}
@@ -0,0 +1,33 @@
+// Package storage saves uploaded files. Files are addressed by a key like
+// "attachments/<id>.jpg" and served to clients from the URL the backend
+// returns for it.
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+var ErrInvalidKey = errors.New("invalid storage key")
+
+type Storage interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Delete(ctx context.Context, key string) error
+	// URL is where clients can download the file from.
+	URL(key string) string
+}
+
+// validateKey only allows relative, slash separated keys without any "." or
+// ".." segments, so a key can't escape the directory or bucket.
+func validateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return ErrInvalidKey
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return ErrInvalidKey
+		}
+	}
+	return nil
+}
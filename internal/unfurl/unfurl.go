@@ -0,0 +1,211 @@
+// Package unfurl finds links in chirps and fetches the Open Graph metadata
+// used to show previews of them.
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sam-maton/chirpy/internal/netguard"
+	"golang.org/x/net/html"
+)
+
+const (
+	// MaxBytes is how much of a page is read looking for metadata, which
+	// belongs in the <head> near the start.
+	MaxBytes = 1 << 20
+
+	maxRedirects        = 5
+	maxTitleChars       = 300
+	maxDescriptionChars = 1000
+)
+
+var (
+	ErrBlockedAddress = netguard.ErrBlockedAddress
+	ErrNotHTML        = errors.New("response is not an HTML page")
+	ErrInvalidURL     = errors.New("only http and https URLs can be previewed")
+)
+
+var urlPattern = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+// ExtractURLs returns up to limit distinct http and https URLs from a chirp
+// body, in the order they appear. Punctuation that usually ends a sentence
+// rather than a URL is left off.
+func ExtractURLs(body string, limit int) []string {
+	urls := []string{}
+	for _, match := range urlPattern.FindAllString(body, -1) {
+		if len(urls) >= limit {
+			break
+		}
+
+		match = strings.TrimRight(match, ".,;:!?'")
+		if strings.HasSuffix(match, ")") && !strings.Contains(match, "(") {
+			match = strings.TrimRight(match, ")")
+		}
+
+		u, err := url.Parse(match)
+		if err != nil || u.Hostname() == "" {
+			continue
+		}
+
+		if !slices.Contains(urls, match) {
+			urls = append(urls, match)
+		}
+	}
+	return urls
+}
+
+type Preview struct {
+	Title       string
+	Description string
+	ImageURL    string
+	SiteName    string
+}
+
+type Fetcher struct {
+	Client *http.Client
+}
+
+// NewFetcher returns a Fetcher that will only connect to public addresses.
+func NewFetcher(timeout time.Duration) *Fetcher {
+	return &Fetcher{Client: netguard.NewClient(timeout, checkRedirect)}
+}
+
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return ErrInvalidURL
+	}
+	return nil
+}
+
+// Fetch downloads a page and reads its preview metadata.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (Preview, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return Preview{}, ErrInvalidURL
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return Preview{}, err
+	}
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	req.Header.Set("User-Agent", "Chirpy-LinkPreview/1.0")
+
+	res, err := f.Client.Do(req)
+	if err != nil {
+		return Preview{}, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return Preview{}, fmt.Errorf("page responded with %d", res.StatusCode)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if err != nil || (mediaType != "text/html" && mediaType != "application/xhtml+xml") {
+		return Preview{}, ErrNotHTML
+	}
+
+	return parse(io.LimitReader(res.Body, MaxBytes), res.Request.URL), nil
+}
+
+// parse reads the Open Graph tags from a page's <head>, falling back to the
+// <title> and description meta tag for pages without them. Relative image
+// URLs are resolved against base.
+func parse(r io.Reader, base *url.URL) Preview {
+	og := map[string]string{}
+	title := ""
+	description := ""
+
+	z := html.NewTokenizer(r)
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+
+		token := z.Token()
+		if tt == html.EndTagToken && token.Data == "head" {
+			break
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+
+		switch token.Data {
+		case "body":
+			return buildPreview(og, title, description, base)
+		case "title":
+			if z.Next() == html.TextToken && title == "" {
+				title = string(z.Text())
+			}
+		case "meta":
+			attrs := map[string]string{}
+			for _, a := range token.Attr {
+				attrs[a.Key] = a.Val
+			}
+
+			property := strings.ToLower(attrs["property"])
+			if strings.HasPrefix(property, "og:") {
+				if _, ok := og[property]; !ok {
+					og[property] = attrs["content"]
+				}
+			}
+			if strings.ToLower(attrs["name"]) == "description" && description == "" {
+				description = attrs["content"]
+			}
+		}
+	}
+
+	return buildPreview(og, title, description, base)
+}
+
+func buildPreview(og map[string]string, title, description string, base *url.URL) Preview {
+	preview := Preview{
+		Title:       clean(firstNonEmpty(og["og:title"], title), maxTitleChars),
+		Description: clean(firstNonEmpty(og["og:description"], description), maxDescriptionChars),
+		SiteName:    clean(og["og:site_name"], maxTitleChars),
+	}
+
+	if image := strings.TrimSpace(og["og:image"]); image != "" {
+		u, err := base.Parse(image)
+		if err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+			preview.ImageURL = u.String()
+		}
+	}
+
+	return preview
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// clean collapses whitespace, drops invalid UTF-8 and cuts s to at most
+// maxChars characters.
+func clean(s string, maxChars int) string {
+	s = strings.Join(strings.Fields(strings.ToValidUTF8(s, "")), " ")
+	if utf8.RuneCountInString(s) <= maxChars {
+		return s
+	}
+	return string([]rune(s)[:maxChars-1]) + "…"
+}
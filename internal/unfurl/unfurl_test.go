@@ -0,0 +1,177 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExtractURLs(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		limit int
+		want  []string
+	}{
+		{
+			name:  "No links",
+			body:  "just chirping",
+			limit: 3,
+			want:  []string{},
+		},
+		{
+			name:  "Trailing punctuation",
+			body:  "Read this: https://example.com/post. And https://example.org/a?b=c!",
+			limit: 3,
+			want:  []string{"https://example.com/post", "https://example.org/a?b=c"},
+		},
+		{
+			name:  "Wrapped in brackets",
+			body:  "(see http://example.com/page) and https://en.wikipedia.org/wiki/Go_(game)",
+			limit: 3,
+			want:  []string{"http://example.com/page", "https://en.wikipedia.org/wiki/Go_(game)"},
+		},
+		{
+			name:  "Duplicates and limit",
+			body:  "https://a.example https://a.example https://b.example https://c.example",
+			limit: 2,
+			want:  []string{"https://a.example", "https://b.example"},
+		},
+		{
+			name:  "Other schemes are ignored",
+			body:  "ftp://example.com javascript:alert(1) https://",
+			limit: 3,
+			want:  []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ExtractURLs(tt.body, tt.limit)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ExtractURLs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetch(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/og", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<!doctype html><html><head>
+			<title>Fallback title</title>
+			<meta property="og:title" content="Chirpy &amp; friends">
+			<meta property="og:description" content="  A   place
+				to chirp ">
+			<meta property="og:image" content="/images/card.png">
+			<meta property="og:site_name" content="Chirpy">
+			</head><body><meta property="og:title" content="Not in head"></body></html>`))
+	})
+	mux.HandleFunc("/plain", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Plain page</title><meta name="description" content="Described"></head></html>`))
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/og", http.StatusFound)
+	})
+	mux.HandleFunc("/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	})
+	mux.HandleFunc("/missing", http.NotFound)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	tests := []struct {
+		name    string
+		path    string
+		want    Preview
+		wantErr bool
+	}{
+		{
+			name: "Open Graph tags",
+			path: "/og",
+			want: Preview{
+				Title:       "Chirpy & friends",
+				Description: "A place to chirp",
+				ImageURL:    srv.URL + "/images/card.png",
+				SiteName:    "Chirpy",
+			},
+		},
+		{
+			name: "Falls back to title and description",
+			path: "/plain",
+			want: Preview{Title: "Plain page", Description: "Described"},
+		},
+		{
+			name: "Follows redirects",
+			path: "/redirect",
+			want: Preview{
+				Title:       "Chirpy & friends",
+				Description: "A place to chirp",
+				ImageURL:    srv.URL + "/images/card.png",
+				SiteName:    "Chirpy",
+			},
+		},
+		{name: "Not HTML", path: "/json", wantErr: true},
+		{name: "Not found", path: "/missing", wantErr: true},
+	}
+
+	// The test server is on loopback, which NewFetcher refuses, so these
+	// use a plain client.
+	f := &Fetcher{Client: srv.Client()}
+	f.Client.CheckRedirect = checkRedirect
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := f.Fetch(context.Background(), srv.URL+tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Fetch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Fetch() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchRefusesPrivateAddresses(t *testing.T) {
+	hit := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit = true
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<title>Internal</title>`))
+	}))
+	defer srv.Close()
+
+	f := NewFetcher(time.Second)
+
+	_, err := f.Fetch(context.Background(), srv.URL)
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("Fetch() error = %v, want %v", err, ErrBlockedAddress)
+	}
+
+	// A hostname that resolves to loopback is caught too.
+	_, err = f.Fetch(context.Background(), strings.Replace(srv.URL, "127.0.0.1", "localhost", 1))
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("Fetch() by hostname error = %v, want %v", err, ErrBlockedAddress)
+	}
+
+	if hit {
+		t.Error("the private server was contacted")
+	}
+}
+
+func TestFetchRejectsOtherSchemes(t *testing.T) {
+	f := NewFetcher(time.Second)
+	_, err := f.Fetch(context.Background(), "file:///etc/passwd")
+	if !errors.Is(err, ErrInvalidURL) {
+		t.Errorf("Fetch() error = %v, want %v", err, ErrInvalidURL)
+	}
+}
@@ -0,0 +1,156 @@
+// Package webhooks delivers chirpy events to URLs registered by users. Bodies
+// are signed the same way Polka signs the webhooks it sends us, so receivers
+// can check them with auth.VerifyWebhookSignature.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sam-maton/chirpy/internal/auth"
+	"github.com/sam-maton/chirpy/internal/netguard"
+)
+
+const (
+	EventChirpCreated = "chirp.created"
+	EventChirpDeleted = "chirp.deleted"
+	EventUserUpgraded = "user.upgraded"
+)
+
+const (
+	// MaxAttempts is how many times a delivery is tried before it is given up.
+	MaxAttempts = 8
+
+	baseBackoff = 30 * time.Second
+	maxBackoff  = 6 * time.Hour
+)
+
+var ErrInvalidEvent = errors.New("invalid webhook event")
+
+var validEvents = []string{EventChirpCreated, EventChirpDeleted, EventUserUpgraded}
+
+// ParseEvents validates requested events and returns them in the space
+// separated form they are stored in.
+func ParseEvents(events []string) (string, error) {
+	if len(events) == 0 {
+		return "", ErrInvalidEvent
+	}
+
+	parsed := []string{}
+	for _, e := range events {
+		if !slices.Contains(validEvents, e) {
+			return "", ErrInvalidEvent
+		}
+		if !slices.Contains(parsed, e) {
+			parsed = append(parsed, e)
+		}
+	}
+
+	return strings.Join(parsed, " "), nil
+}
+
+func MakeSecret() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// NewPayload builds the JSON body sent for an event.
+func NewPayload(event string, data any, now time.Time) ([]byte, error) {
+	return json.Marshal(struct {
+		Event     string    `json:"event"`
+		CreatedAt time.Time `json:"created_at"`
+		Data      any       `json:"data"`
+	}{
+		Event:     event,
+		CreatedAt: now.UTC(),
+		Data:      data,
+	})
+}
+
+// Backoff returns how long to wait before the next try after the given
+// number of failed attempts. It doubles each time up to a maximum.
+func Backoff(attempts int) time.Duration {
+	if attempts < 1 {
+		return baseBackoff
+	}
+
+	delay := baseBackoff
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= maxBackoff {
+			return maxBackoff
+		}
+	}
+	return delay
+}
+
+type Delivery struct {
+	ID      string
+	Event   string
+	URL     string
+	Secret  string
+	Payload []byte
+}
+
+type Sender struct {
+	Client *http.Client
+	Now    func() time.Time
+}
+
+// NewSender returns a Sender that will only deliver to public addresses, so
+// a webhook URL can't be used to reach internal services. Redirects aren't
+// followed, and count as a failed delivery.
+func NewSender(timeout time.Duration) *Sender {
+	return &Sender{
+		Client: netguard.NewClient(timeout, func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}),
+		Now: time.Now,
+	}
+}
+
+// Send posts a delivery and returns the receiver's status code, or 0 if no
+// response was received. Anything other than a 2xx response is an error.
+func (s *Sender) Send(ctx context.Context, d Delivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(s.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Chirpy-Webhooks/1.0")
+	req.Header.Set("X-Chirpy-Event", d.Event)
+	req.Header.Set("X-Chirpy-Delivery", d.ID)
+	req.Header.Set("X-Chirpy-Timestamp", timestamp)
+	req.Header.Set("X-Chirpy-Signature", "v1="+auth.SignWebhook(d.Secret, timestamp, d.Payload))
+
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	// Drain a little of the body so the connection can be reused.
+	io.Copy(io.Discard, io.LimitReader(res.Body, 4096))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("receiver responded with %d", res.StatusCode)
+	}
+	return res.StatusCode, nil
+}
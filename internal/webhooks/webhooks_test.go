@@ -0,0 +1,154 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sam-maton/chirpy/internal/auth"
+	"github.com/sam-maton/chirpy/internal/netguard"
+)
+
+func TestSend(t *testing.T) {
+	secret := "whsec_test"
+	payload, err := NewPayload(EventChirpCreated, map[string]string{"id": "123"}, time.Now())
+	if err != nil {
+		t.Fatalf("unexpected error building payload: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		status     int
+		wantStatus int
+		wantErr    bool
+	}{
+		{name: "Accepted", status: http.StatusNoContent, wantStatus: http.StatusNoContent, wantErr: false},
+		{name: "Receiver error", status: http.StatusInternalServerError, wantStatus: http.StatusInternalServerError, wantErr: true},
+		{name: "Receiver rejects", status: http.StatusGone, wantStatus: http.StatusGone, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var verifyErr error
+			var gotEvent, gotDelivery string
+			receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				verifyErr = auth.VerifyWebhookSignature(
+					body,
+					r.Header.Get("X-Chirpy-Timestamp"),
+					r.Header.Get("X-Chirpy-Signature"),
+					[]string{secret},
+					5*time.Minute,
+					time.Now(),
+				)
+				gotEvent = r.Header.Get("X-Chirpy-Event")
+				gotDelivery = r.Header.Get("X-Chirpy-Delivery")
+				w.WriteHeader(tt.status)
+			}))
+			defer receiver.Close()
+
+			// The receiver is on loopback, which NewSender refuses.
+			sender := &Sender{Client: receiver.Client(), Now: time.Now}
+			status, err := sender.Send(context.Background(), Delivery{
+				ID:      "delivery-1",
+				Event:   EventChirpCreated,
+				URL:     receiver.URL,
+				Secret:  secret,
+				Payload: payload,
+			})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if status != tt.wantStatus {
+				t.Errorf("Send() status = %d, want %d", status, tt.wantStatus)
+			}
+			if verifyErr != nil {
+				t.Errorf("receiver could not verify signature: %v", verifyErr)
+			}
+			if gotEvent != EventChirpCreated || gotDelivery != "delivery-1" {
+				t.Errorf("unexpected headers: event %q, delivery %q", gotEvent, gotDelivery)
+			}
+		})
+	}
+}
+
+func TestSendUnreachable(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := receiver.URL
+	receiver.Close()
+
+	sender := &Sender{Client: &http.Client{Timeout: time.Second}, Now: time.Now}
+	status, err := sender.Send(context.Background(), Delivery{URL: url, Payload: []byte("{}")})
+	if err == nil {
+		t.Fatal("expected an error sending to a closed server")
+	}
+	if status != 0 {
+		t.Errorf("status = %d, want 0", status)
+	}
+}
+
+func TestSendRefusesPrivateAddresses(t *testing.T) {
+	hit := false
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit = true
+	}))
+	defer receiver.Close()
+
+	status, err := NewSender(time.Second).Send(context.Background(), Delivery{URL: receiver.URL, Payload: []byte("{}")})
+	if !errors.Is(err, netguard.ErrBlockedAddress) {
+		t.Errorf("Send() error = %v, want %v", err, netguard.ErrBlockedAddress)
+	}
+	if status != 0 {
+		t.Errorf("status = %d, want 0", status)
+	}
+	if hit {
+		t.Error("the private receiver was contacted")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: 30 * time.Second},
+		{attempts: 2, want: time.Minute},
+		{attempts: 3, want: 2 * time.Minute},
+		{attempts: 20, want: 6 * time.Hour},
+	}
+	for _, tt := range tests {
+		got := Backoff(tt.attempts)
+		if got != tt.want {
+			t.Errorf("Backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestParseEvents(t *testing.T) {
+	tests := []struct {
+		name    string
+		events  []string
+		want    string
+		wantErr bool
+	}{
+		{name: "Valid events", events: []string{"chirp.created", "chirp.deleted"}, want: "chirp.created chirp.deleted"},
+		{name: "Duplicates removed", events: []string{"user.upgraded", "user.upgraded"}, want: "user.upgraded"},
+		{name: "Unknown event", events: []string{"chirp.liked"}, wantErr: true},
+		{name: "No events", events: nil, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseEvents(tt.events)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseEvents() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseEvents() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
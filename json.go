@@ -1,11 +1,15 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
 	"log"
 	"net/http"
 	"slices"
 	"strings"
+	"time"
+
+	"github.com/google/uuid"
 )
 
 func respondWithError(w http.ResponseWriter, message string, code int, err error) {
@@ -35,6 +39,29 @@ func respondWithJson(w http.ResponseWriter, code int, payload interface{}) {
 	w.Write(dat)
 }
 
+// The null*Ptr helpers turn nullable database columns into pointers, which
+// encode as null in JSON responses.
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func nullStringPtr(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	return &s.String
+}
+
+func nullUUIDPtr(id uuid.NullUUID) *uuid.UUID {
+	if !id.Valid {
+		return nil
+	}
+	return &id.UUID
+}
+
 func cleanChirp(message string) string {
 	badWords := []string{"kerfuffle", "sharbert", "fornax"}
 
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sam-maton/chirpy/internal/database"
+	"github.com/sam-maton/chirpy/internal/unfurl"
+)
+
+const (
+	maxLinkPreviews       = 3
+	linkPreviewTTL        = 7 * 24 * time.Hour
+	linkPreviewInterval   = 5 * time.Second
+	linkPreviewBatch      = 10
+	linkPreviewAttempts   = 3
+	linkPreviewRetryDelay = 10 * time.Minute
+)
+
+type linkPreviewResponse struct {
+	URL         string  `json:"url"`
+	Title       *string `json:"title"`
+	Description *string `json:"description"`
+	ImageURL    *string `json:"image_url"`
+	SiteName    *string `json:"site_name"`
+}
+
+func linkPreviewToResponse(p database.GetLinkPreviewsByChirpIDsRow) linkPreviewResponse {
+	return linkPreviewResponse{
+		URL:         p.Url,
+		Title:       nullStringPtr(p.Title),
+		Description: nullStringPtr(p.Description),
+		ImageURL:    nullStringPtr(p.ImageUrl),
+		SiteName:    nullStringPtr(p.SiteName),
+	}
+}
+
+// saveChirpLinks records the links in a chirp's body and queues any that
+// haven't been fetched recently. Previews are fetched in the background by
+// runLinkPreviewFetcher, so a new chirp has none until that catches up.
+func saveChirpLinks(ctx context.Context, q *database.Queries, chirp database.Chirp) error {
+	err := q.DeleteChirpLinks(ctx, chirp.ID)
+	if err != nil {
+		return err
+	}
+
+	for i, url := range unfurl.ExtractURLs(chirp.Body, maxLinkPreviews) {
+		err = q.QueueLinkPreview(ctx, database.QueueLinkPreviewParams{
+			Url:         url,
+			StaleBefore: time.Now().Add(-linkPreviewTTL),
+		})
+		if err != nil {
+			return err
+		}
+
+		err = q.CreateChirpLink(ctx, database.CreateChirpLinkParams{
+			ChirpID:  chirp.ID,
+			Position: int32(i),
+			Url:      url,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runLinkPreviewFetcher fetches queued link previews until ctx is
+// cancelled. Any number of servers can run it against the same database.
+func (cfg *apiConfig) runLinkPreviewFetcher(ctx context.Context) {
+	ticker := time.NewTicker(linkPreviewInterval)
+	defer ticker.Stop()
+
+	for {
+		cfg.fetchLinkPreviews(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (cfg *apiConfig) fetchLinkPreviews(ctx context.Context) {
+	claimed, err := cfg.db.ClaimLinkPreviews(ctx, linkPreviewBatch)
+	if err != nil {
+		log.Printf("There was an error claiming link previews: %s", err)
+		return
+	}
+
+	for _, c := range claimed {
+		preview, fetchErr := cfg.linkFetcher.Fetch(ctx, c.Url)
+
+		if fetchErr == nil {
+			err = cfg.db.SaveLinkPreview(ctx, database.SaveLinkPreviewParams{
+				Url:         c.Url,
+				Title:       optionalString(preview.Title),
+				Description: optionalString(preview.Description),
+				ImageUrl:    optionalString(preview.ImageURL),
+				SiteName:    optionalString(preview.SiteName),
+			})
+		} else {
+			status := "pending"
+			// Trying again won't change the answer for these.
+			permanent := errors.Is(fetchErr, unfurl.ErrBlockedAddress) ||
+				errors.Is(fetchErr, unfurl.ErrNotHTML) ||
+				errors.Is(fetchErr, unfurl.ErrInvalidURL)
+			if permanent || c.Attempts >= linkPreviewAttempts {
+				status = "failed"
+			}
+
+			err = cfg.db.MarkLinkPreviewFailed(ctx, database.MarkLinkPreviewFailedParams{
+				Url:           c.Url,
+				Status:        status,
+				NextAttemptAt: time.Now().Add(linkPreviewRetryDelay),
+				LastError:     sql.NullString{String: fetchErr.Error(), Valid: true},
+			})
+		}
+		if err != nil {
+			log.Printf("There was an error saving the link preview for %s: %s", c.Url, err)
+		}
+	}
+}
+
+// linkPreviewsByChirp loads the previews of all the chirps in one query.
+func (cfg *apiConfig) linkPreviewsByChirp(ctx context.Context, chirpIds []uuid.UUID) (map[uuid.UUID][]linkPreviewResponse, error) {
+	previews, err := cfg.db.GetLinkPreviewsByChirpIDs(ctx, chirpIds)
+	if err != nil {
+		return nil, err
+	}
+
+	byChirp := map[uuid.UUID][]linkPreviewResponse{}
+	for _, p := range previews {
+		byChirp[p.ChirpID] = append(byChirp[p.ChirpID], linkPreviewToResponse(p))
+	}
+	return byChirp, nil
+}
+
+func optionalString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sam-maton/chirpy/internal/auth"
+	"github.com/sam-maton/chirpy/internal/database"
+	"github.com/sam-maton/chirpy/internal/entitlements"
+)
+
+// loginRetryAfter checks both the per-account and the per-IP failed login
+// history and returns how long the client has to wait before trying again.
+func (cfg *apiConfig) loginRetryAfter(r *http.Request, email string) (time.Duration, error) {
+	now := time.Now()
+
+	ipStats, err := cfg.db.GetFailedLoginStatsByIP(r.Context(), database.GetFailedLoginStatsByIPParams{
+		IpAddress: cfg.clientIP(r),
+		Since:     now.Add(-cfg.ipLoginThrottle.Window),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	emailStats, err := cfg.db.GetFailedLoginStatsByEmail(r.Context(), database.GetFailedLoginStatsByEmailParams{
+		Email: email,
+		Since: now.Add(-cfg.accountLoginThrottle.Window),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	ipWait := cfg.ipLoginThrottle.RetryAfter(int(ipStats.Failures), ipStats.LastFailedAt, now)
+	emailWait := cfg.accountLoginThrottle.RetryAfter(int(emailStats.Failures), emailStats.LastFailedAt, now)
+
+	return max(ipWait, emailWait), nil
+}
+
+// recordLoginAttempt writes the audit record for a login attempt. Failures
+// here are logged rather than failing the login.
+func (cfg *apiConfig) recordLoginAttempt(r *http.Request, email string, userId uuid.NullUUID, succeeded bool) {
+	err := cfg.db.CreateLoginAttempt(r.Context(), database.CreateLoginAttemptParams{
+		Email:     email,
+		IpAddress: cfg.clientIP(r),
+		UserAgent: r.UserAgent(),
+		UserID:    userId,
+		Succeeded: succeeded,
+	})
+	if err != nil {
+		log.Printf("There was an error recording the login attempt: %s", err)
+	}
+
+	if !succeeded {
+		log.Printf("Failed login attempt for %q from %s", email, cfg.clientIP(r))
+	}
+}
+
+func respondWithTooManyRequests(w http.ResponseWriter, message string, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	respondWithError(w, message, http.StatusTooManyRequests, nil)
+}
+
+// respondWithSession issues a new access token and refresh token for a user
+// that has fully logged in. Suspended and banned users are turned away here
+// whichever way they logged in.
+func (cfg *apiConfig) respondWithSession(w http.ResponseWriter, r *http.Request, user database.User) {
+	type response struct {
+		IsChirpyRed  bool      `json:"is_chirpy_red"`
+		Badges       []string  `json:"badges"`
+		ID           uuid.UUID `json:"id"`
+		Email        string    `json:"email"`
+		Token        string    `json:"token"`
+		RefreshToken string    `json:"refresh_token"`
+		AvatarURL    *string   `json:"avatar_url"`
+		BannerURL    *string   `json:"banner_url"`
+	}
+
+	if rejectDisabledAccount(w, accountStatusFromUser(user)) {
+		return
+	}
+
+	isChirpyRed, err := cfg.db.IsUserChirpyRed(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, "There was an error getting the user's subscription", http.StatusInternalServerError, err)
+		return
+	}
+
+	accessToken, err := auth.MakeJWT(user.ID, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, "Couldn't create JWT", http.StatusInternalServerError, err)
+		return
+	}
+
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(w, "Couldn't create refresh token", http.StatusInternalServerError, err)
+		return
+	}
+
+	refreshTokenParams := database.CreateRefreshTokenParams{
+		Token:     refreshToken,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		ExpiresAt: (time.Now().Add(time.Hour * 1440)),
+		UserID:    user.ID,
+	}
+	_, err = cfg.db.CreateRefreshToken(r.Context(), refreshTokenParams)
+	if err != nil {
+		respondWithError(w, "Couldn't save refresh token", http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJson(w, 200, response{
+		ID:           user.ID,
+		Email:        user.Email,
+		IsChirpyRed:  isChirpyRed,
+		Badges:       entitlements.For(isChirpyRed).Badges,
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		AvatarURL:    cfg.storageURL(user.AvatarKey),
+		BannerURL:    cfg.storageURL(user.BannerKey),
+	},
+	)
+}
+
+// respondWithMFAChallenge is sent instead of a session when the password was
+// correct but the user has two-factor authentication enabled. The MFA token
+// is exchanged for a session at POST /api/login/mfa.
+func (cfg *apiConfig) respondWithMFAChallenge(w http.ResponseWriter, user database.User) {
+	type response struct {
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+	}
+
+	mfaToken, err := auth.MakeMFAToken(user.ID, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, "Couldn't create MFA token", http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJson(w, 200, response{
+		MFARequired: true,
+		MFAToken:    mfaToken,
+	})
+}
+
+// rehashPassword replaces a stored hash made with an old algorithm or old
+// parameters. The login carries on even if this fails, it'll be retried next
+// time. Nothing is saved if the password was changed since oldHash was read.
+func (cfg *apiConfig) rehashPassword(ctx context.Context, userId uuid.UUID, oldHash, password string) {
+	hashedPW, err := cfg.passwords.Hash(password)
+	if err != nil {
+		log.Printf("There was an error rehashing the password: %s", err)
+		return
+	}
+
+	_, err = cfg.db.UpdateUserPasswordHash(ctx, database.UpdateUserPasswordHashParams{
+		NewHash: hashedPW,
+		ID:      userId,
+		OldHash: oldHash,
+	})
+	if err != nil {
+		log.Printf("There was an error saving the rehashed password: %s", err)
+	}
+}
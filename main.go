@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 
 	_ "github.com/lib/pq"
+	"github.com/sam-maton/chirpy/internal/auth"
 )
 
 func appIndexHandler() http.Handler {
@@ -22,33 +24,98 @@ func main() {
 	//App Handlers
 	mux.HandleFunc("/", redirectToApp)
 	mux.Handle("/app/", apiCfg.middlewareMetricInc(appIndexHandler()))
+	if apiCfg.mediaHandler != nil {
+		mux.Handle("GET /media/", http.StripPrefix("/media", apiCfg.mediaHandler))
+	}
 
 	//Admin Handlers
-	mux.HandleFunc("GET /admin/metrics", apiCfg.handlerMetricHits)
-	mux.HandleFunc("POST /admin/reset", apiCfg.handlerReset)
+	mux.HandleFunc("GET /admin/metrics", apiCfg.middlewareRequireRole(auth.RoleAdmin, apiCfg.handlerMetricHits))
+	mux.HandleFunc("POST /admin/reset", apiCfg.middlewareRequireRole(auth.RoleAdmin, apiCfg.handlerReset))
+	mux.HandleFunc("PUT /admin/users/{id}/role", apiCfg.middlewareRequireRole(auth.RoleAdmin, apiCfg.handlerSetUserRole))
+	mux.HandleFunc("POST /admin/users/{id}/suspend", apiCfg.middlewareRequireRole(auth.RoleAdmin, apiCfg.handlerSuspendUser))
+	mux.HandleFunc("DELETE /admin/users/{id}/suspend", apiCfg.middlewareRequireRole(auth.RoleAdmin, apiCfg.handlerUnsuspendUser))
+	mux.HandleFunc("GET /admin/webhooks", apiCfg.middlewareRequireRole(auth.RoleAdmin, apiCfg.handlerGetWebhookEvents))
+	mux.HandleFunc("GET /admin/webhooks/{id}", apiCfg.middlewareRequireRole(auth.RoleAdmin, apiCfg.handlerGetWebhookEvent))
+	mux.HandleFunc("POST /admin/webhooks/{id}/replay", apiCfg.middlewareRequireRole(auth.RoleAdmin, apiCfg.handlerReplayWebhookEvent))
 
 	//API Handlers
-	mux.HandleFunc("POST /api/users", apiCfg.handlerCreateUser)
-	mux.HandleFunc("PUT /api/users", apiCfg.middlewareAuth(apiCfg.handlerUpdateUser))
+	mux.HandleFunc("POST /api/users", apiCfg.middlewareRateLimitIP(signupRateLimit, apiCfg.handlerCreateUser))
+	mux.HandleFunc("PUT /api/users", apiCfg.middlewareAuth(auth.ScopeProfileWrite, apiCfg.handlerUpdateUser))
+	mux.HandleFunc("PUT /api/users/avatar", apiCfg.middlewareAuth(auth.ScopeProfileWrite, apiCfg.handlerUploadAvatar))
+	mux.HandleFunc("DELETE /api/users/avatar", apiCfg.middlewareAuth(auth.ScopeProfileWrite, apiCfg.handlerDeleteAvatar))
+	mux.HandleFunc("PUT /api/users/banner", apiCfg.middlewareAuth(auth.ScopeProfileWrite, apiCfg.handlerUploadBanner))
+	mux.HandleFunc("DELETE /api/users/banner", apiCfg.middlewareAuth(auth.ScopeProfileWrite, apiCfg.handlerDeleteBanner))
+	mux.HandleFunc("GET /api/users/subscription", apiCfg.middlewareAuth(sessionOnly, apiCfg.handlerGetSubscription))
+	mux.HandleFunc("GET /api/users/{id}", apiCfg.handlerGetUserProfile)
+
+	mux.HandleFunc("POST /api/users/{id}/block", apiCfg.middlewareAuth(sessionOnly, apiCfg.handlerBlockUser))
+	mux.HandleFunc("DELETE /api/users/{id}/block", apiCfg.middlewareAuth(sessionOnly, apiCfg.handlerUnblockUser))
+	mux.HandleFunc("GET /api/blocks", apiCfg.middlewareAuth(sessionOnly, apiCfg.handlerGetBlockedUsers))
+	mux.HandleFunc("POST /api/users/{id}/mute", apiCfg.middlewareAuth(sessionOnly, apiCfg.handlerMuteUser))
+	mux.HandleFunc("DELETE /api/users/{id}/mute", apiCfg.middlewareAuth(sessionOnly, apiCfg.handlerUnmuteUser))
+	mux.HandleFunc("GET /api/mutes", apiCfg.middlewareAuth(sessionOnly, apiCfg.handlerGetMutedUsers))
 
-	mux.HandleFunc("POST /api/login", apiCfg.handlerLoginUser)
-	mux.HandleFunc("POST /api/refresh", apiCfg.handlerRefresh)
+	mux.HandleFunc("POST /api/login", apiCfg.middlewareRateLimitIP(loginRateLimit, apiCfg.handlerLoginUser))
+	mux.HandleFunc("POST /api/login/mfa", apiCfg.middlewareRateLimitIP(loginRateLimit, apiCfg.handlerLoginMFA))
+	mux.HandleFunc("GET /api/auth/oidc/login", apiCfg.handlerOIDCLogin)
+	mux.HandleFunc("GET /api/auth/oidc/callback", apiCfg.handlerOIDCCallback)
+	mux.HandleFunc("POST /api/refresh", apiCfg.middlewareRateLimitIP(refreshRateLimit, apiCfg.handlerRefresh))
 	mux.HandleFunc("POST /api/revoke", apiCfg.handlerRevoke)
 
-	mux.HandleFunc("GET /api/chirps", apiCfg.handlerGetAllChirps)
-	mux.HandleFunc("GET /api/chirps/{id}", apiCfg.handlerGetOneChirp)
-	mux.HandleFunc("POST /api/chirps", apiCfg.middlewareAuth(apiCfg.handlerCreateChirp))
-	mux.HandleFunc("DELETE /api/chirps/{id}", apiCfg.middlewareAuth(apiCfg.handlerDeleteChirp))
+	mux.HandleFunc("POST /api/mfa/totp", apiCfg.middlewareAuth(sessionOnly, apiCfg.handlerEnrollTOTP))
+	mux.HandleFunc("POST /api/mfa/totp/confirm", apiCfg.middlewareAuth(sessionOnly, apiCfg.handlerConfirmTOTP))
+	mux.HandleFunc("DELETE /api/mfa/totp", apiCfg.middlewareAuth(sessionOnly, apiCfg.handlerDisableTOTP))
+
+	mux.HandleFunc("POST /api/tokens", apiCfg.middlewareAuth(sessionOnly, apiCfg.handlerCreateAPIToken))
+	mux.HandleFunc("GET /api/tokens", apiCfg.middlewareAuth(sessionOnly, apiCfg.handlerGetAPITokens))
+	mux.HandleFunc("DELETE /api/tokens/{id}", apiCfg.middlewareAuth(sessionOnly, apiCfg.handlerRevokeAPIToken))
+
+	mux.HandleFunc("POST /api/conversations", apiCfg.middlewareAuth(sessionOnly, apiCfg.handlerStartConversation))
+	mux.HandleFunc("GET /api/conversations", apiCfg.middlewareAuth(sessionOnly, apiCfg.handlerGetConversations))
+	mux.HandleFunc("GET /api/conversations/{id}/messages", apiCfg.middlewareAuth(sessionOnly, apiCfg.handlerGetMessages))
+	mux.HandleFunc("POST /api/conversations/{id}/messages", apiCfg.middlewareAuth(sessionOnly, apiCfg.middlewareRateLimitUser(messageRateLimit, apiCfg.handlerSendMessage)))
+	mux.HandleFunc("POST /api/conversations/{id}/read", apiCfg.middlewareAuth(sessionOnly, apiCfg.handlerMarkConversationRead))
+
+	mux.HandleFunc("GET /api/chirps", apiCfg.middlewareOptionalAuth(auth.ScopeChirpsRead, apiCfg.handlerGetAllChirps))
+	mux.HandleFunc("GET /api/chirps/stream", apiCfg.handlerChirpStream)
+	mux.HandleFunc("GET /api/chirps/scheduled", apiCfg.middlewareAuth(auth.ScopeChirpsRead, apiCfg.handlerGetScheduledChirps))
+	mux.HandleFunc("GET /api/chirps/{id}", apiCfg.middlewareOptionalAuth(auth.ScopeChirpsRead, apiCfg.handlerGetOneChirp))
+	mux.HandleFunc("POST /api/chirps", apiCfg.middlewareAuth(auth.ScopeChirpsWrite, apiCfg.handlerCreateChirp))
+	mux.HandleFunc("PUT /api/chirps/{id}", apiCfg.middlewareAuth(auth.ScopeChirpsWrite, apiCfg.handlerUpdateChirp))
+	mux.HandleFunc("DELETE /api/chirps/{id}", apiCfg.middlewareAuth(auth.ScopeChirpsWrite, apiCfg.handlerDeleteChirp))
+	mux.HandleFunc("POST /api/chirps/{id}/report", apiCfg.middlewareAuth(auth.ScopeChirpsWrite, apiCfg.middlewareRateLimitUser(reportRateLimit, apiCfg.handlerReportChirp)))
+	mux.HandleFunc("PUT /api/chirps/{id}/schedule", apiCfg.middlewareAuth(auth.ScopeChirpsWrite, apiCfg.handlerRescheduleChirp))
+	mux.HandleFunc("DELETE /api/chirps/{id}/schedule", apiCfg.middlewareAuth(auth.ScopeChirpsWrite, apiCfg.handlerCancelScheduledChirp))
+	mux.HandleFunc("POST /api/chirps/{id}/poll/vote", apiCfg.middlewareAuth(auth.ScopeChirpsWrite, apiCfg.handlerVotePoll))
+
+	mux.HandleFunc("GET /api/moderation/reports", apiCfg.middlewareRequireRole(auth.RoleModerator, apiCfg.handlerGetReports))
+	mux.HandleFunc("POST /api/moderation/reports/{id}/resolve", apiCfg.middlewareRequireRole(auth.RoleModerator, apiCfg.handlerResolveReport))
+	mux.HandleFunc("GET /api/moderation/actions", apiCfg.middlewareRequireRole(auth.RoleModerator, apiCfg.handlerGetModerationActions))
+
+	mux.HandleFunc("POST /api/webhooks", apiCfg.middlewareAuth(sessionOnly, apiCfg.handlerCreateWebhookSubscription))
+	mux.HandleFunc("GET /api/webhooks", apiCfg.middlewareAuth(sessionOnly, apiCfg.handlerGetWebhookSubscriptions))
+	mux.HandleFunc("DELETE /api/webhooks/{id}", apiCfg.middlewareAuth(sessionOnly, apiCfg.handlerDeleteWebhookSubscription))
+	mux.HandleFunc("GET /api/webhooks/{id}/deliveries", apiCfg.middlewareAuth(sessionOnly, apiCfg.handlerGetWebhookDeliveries))
+
+	mux.HandleFunc("GET /api/ws", apiCfg.handlerWebSocket)
 
 	mux.HandleFunc("GET /api/healthz", handlerReadiness)
 	mux.HandleFunc("POST /api/validate_chirp", handlerValidateChirp)
-	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.handlerPolkaWebhook)
+	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.middlewareRateLimitIP(webhookRateLimit, apiCfg.handlerPolkaWebhook))
 
 	server := http.Server{
 		Handler: mux,
 		Addr:    ":8080",
 	}
 
+	go apiCfg.runWebhookDispatcher(context.Background())
+	go apiCfg.runEventListener(context.Background())
+	go apiCfg.runLinkPreviewFetcher(context.Background())
+	go apiCfg.runChirpScheduler(context.Background())
+	if _, ok := apiCfg.rateLimits.(pgRateLimitStore); ok {
+		go apiCfg.runRateLimitCleanup(context.Background())
+	}
+
 	log.Printf("Running chirpy server on http://localhost%s", server.Addr)
 	server.ListenAndServe()
 }
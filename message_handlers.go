@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/sam-maton/chirpy/internal/database"
+)
+
+const (
+	maxMessageLength = 2000
+
+	eventMessageCreated = "message.created"
+	eventMessagesRead   = "messages.read"
+)
+
+var errNotInConversation = errors.New("user is not part of the conversation")
+
+type conversationResponse struct {
+	ID            uuid.UUID  `json:"id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	OtherUserID   uuid.UUID  `json:"other_user_id"`
+	LastMessageAt *time.Time `json:"last_message_at"`
+	UnreadCount   int64      `json:"unread_count"`
+}
+
+type messageResponse struct {
+	ID             uuid.UUID  `json:"id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ConversationID uuid.UUID  `json:"conversation_id"`
+	SenderID       uuid.UUID  `json:"sender_id"`
+	Body           string     `json:"body"`
+	ReadAt         *time.Time `json:"read_at"`
+}
+
+// MESSAGE HANDLERS
+func (cfg *apiConfig) handlerStartConversation(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	type params struct {
+		UserID uuid.UUID `json:"user_id"`
+	}
+
+	p := params{}
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&p)
+	if err != nil {
+		respondWithError(w, paramsDecodeError, http.StatusBadRequest, err)
+		return
+	}
+
+	if p.UserID == userId {
+		respondWithError(w, "You can't message yourself", http.StatusBadRequest, nil)
+		return
+	}
+
+	_, err = cfg.db.GetUserByID(r.Context(), p.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, "User could not be found", http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, "There was an error getting the user", http.StatusInternalServerError, err)
+		return
+	}
+
+	blocked, err := cfg.db.IsBlockedBetween(r.Context(), database.IsBlockedBetweenParams{
+		UserID:      userId,
+		OtherUserID: p.UserID,
+	})
+	if err != nil {
+		respondWithError(w, "There was an error checking blocked users", http.StatusInternalServerError, err)
+		return
+	}
+	if blocked {
+		respondWithError(w, "You can't message this user", http.StatusForbidden, nil)
+		return
+	}
+
+	userA, userB := conversationPair(userId, p.UserID)
+	conversation, err := cfg.db.GetOrCreateConversation(r.Context(), database.GetOrCreateConversationParams{
+		UserAID: userA,
+		UserBID: userB,
+	})
+	if err != nil {
+		respondWithError(w, "There was an error creating the conversation", http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJson(w, 200, conversationResponse{
+		ID:            conversation.ID,
+		CreatedAt:     conversation.CreatedAt,
+		OtherUserID:   p.UserID,
+		LastMessageAt: nullTimePtr(conversation.LastMessageAt),
+	})
+}
+
+func (cfg *apiConfig) handlerGetConversations(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	conversations, err := cfg.db.GetConversationsByUserID(r.Context(), database.GetConversationsByUserIDParams{
+		UserID: userId,
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		respondWithError(w, "There was an error getting the conversations", http.StatusInternalServerError, err)
+		return
+	}
+
+	response := []conversationResponse{}
+	for _, c := range conversations {
+		response = append(response, conversationResponse{
+			ID:            c.ID,
+			CreatedAt:     c.CreatedAt,
+			OtherUserID:   c.OtherUserID,
+			LastMessageAt: nullTimePtr(c.LastMessageAt),
+			UnreadCount:   c.UnreadCount,
+		})
+	}
+
+	respondWithJson(w, 200, response)
+}
+
+func (cfg *apiConfig) handlerGetMessages(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	conversation, ok := cfg.conversationFromPath(w, r, userId)
+	if !ok {
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	messages, err := cfg.db.GetMessagesByConversationID(r.Context(), database.GetMessagesByConversationIDParams{
+		ConversationID: conversation.ID,
+		Limit:          limit,
+		Offset:         offset,
+	})
+	if err != nil {
+		respondWithError(w, "There was an error getting the messages", http.StatusInternalServerError, err)
+		return
+	}
+
+	response := []messageResponse{}
+	for _, m := range messages {
+		response = append(response, messageToResponse(m))
+	}
+
+	respondWithJson(w, 200, response)
+}
+
+func (cfg *apiConfig) handlerSendMessage(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	type params struct {
+		Body string `json:"body"`
+		// Clean replaces profanity the same way chirps are cleaned.
+		Clean bool `json:"clean"`
+	}
+
+	conversation, ok := cfg.conversationFromPath(w, r, userId)
+	if !ok {
+		return
+	}
+
+	p := params{}
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&p)
+	if err != nil {
+		respondWithError(w, paramsDecodeError, http.StatusBadRequest, err)
+		return
+	}
+
+	if strings.TrimSpace(p.Body) == "" {
+		respondWithError(w, "Message can't be empty", http.StatusBadRequest, nil)
+		return
+	}
+	if utf8.RuneCountInString(p.Body) > maxMessageLength {
+		respondWithError(w, "Message is too long", http.StatusBadRequest, nil)
+		return
+	}
+
+	recipientId := otherParticipant(conversation, userId)
+	blocked, err := cfg.db.IsBlockedBetween(r.Context(), database.IsBlockedBetweenParams{
+		UserID:      userId,
+		OtherUserID: recipientId,
+	})
+	if err != nil {
+		respondWithError(w, "There was an error checking blocked users", http.StatusInternalServerError, err)
+		return
+	}
+	if blocked {
+		respondWithError(w, "You can't message this user", http.StatusForbidden, nil)
+		return
+	}
+
+	body := p.Body
+	if p.Clean {
+		body = cleanChirp(body)
+	}
+
+	message, err := cfg.createMessage(r.Context(), conversation.ID, userId, body)
+	if err != nil {
+		respondWithError(w, "There was an error sending the message", http.StatusInternalServerError, err)
+		return
+	}
+
+	response := messageToResponse(message)
+	cfg.publishNotification(r.Context(), recipientId, eventMessageCreated, response)
+	// The sender's other devices need the message too.
+	cfg.publishNotification(r.Context(), userId, eventMessageCreated, response)
+
+	respondWithJson(w, 201, response)
+}
+
+func (cfg *apiConfig) handlerMarkConversationRead(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	conversation, ok := cfg.conversationFromPath(w, r, userId)
+	if !ok {
+		return
+	}
+
+	marked, err := cfg.db.MarkConversationRead(r.Context(), database.MarkConversationReadParams{
+		ConversationID: conversation.ID,
+		UserID:         userId,
+	})
+	if err != nil {
+		respondWithError(w, "There was an error marking the messages as read", http.StatusInternalServerError, err)
+		return
+	}
+
+	if marked > 0 {
+		cfg.publishNotification(r.Context(), otherParticipant(conversation, userId), eventMessagesRead, struct {
+			ConversationID uuid.UUID `json:"conversation_id"`
+			ReadBy         uuid.UUID `json:"read_by"`
+		}{
+			ConversationID: conversation.ID,
+			ReadBy:         userId,
+		})
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) createMessage(ctx context.Context, conversationId, senderId uuid.UUID, body string) (database.Message, error) {
+	tx, err := cfg.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return database.Message{}, err
+	}
+	defer tx.Rollback()
+
+	qtx := cfg.db.WithTx(tx)
+
+	message, err := qtx.CreateMessage(ctx, database.CreateMessageParams{
+		ConversationID: conversationId,
+		SenderID:       senderId,
+		Body:           body,
+	})
+	if err != nil {
+		return database.Message{}, err
+	}
+
+	err = qtx.TouchConversation(ctx, conversationId)
+	if err != nil {
+		return database.Message{}, err
+	}
+
+	return message, tx.Commit()
+}
+
+// conversationFromPath loads the conversation in the {id} path value and
+// checks the user is part of it. It writes the error response itself and
+// returns false if anything is wrong.
+func (cfg *apiConfig) conversationFromPath(w http.ResponseWriter, r *http.Request, userId uuid.UUID) (database.Conversation, bool) {
+	conversationId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, "Not a valid ID", http.StatusBadRequest, err)
+		return database.Conversation{}, false
+	}
+
+	conversation, err := cfg.db.GetConversationByID(r.Context(), conversationId)
+	if err == nil && conversation.UserAID != userId && conversation.UserBID != userId {
+		err = errNotInConversation
+	}
+	// Other people's conversations are reported as missing rather than
+	// forbidden so their IDs can't be probed.
+	if errors.Is(err, sql.ErrNoRows) || errors.Is(err, errNotInConversation) {
+		respondWithError(w, "Conversation could not be found", http.StatusNotFound, err)
+		return database.Conversation{}, false
+	}
+	if err != nil {
+		respondWithError(w, "There was an error getting the conversation", http.StatusInternalServerError, err)
+		return database.Conversation{}, false
+	}
+
+	return conversation, true
+}
+
+// conversationPair orders two user IDs the way the conversations table
+// stores them, lowest first.
+func conversationPair(a, b uuid.UUID) (uuid.UUID, uuid.UUID) {
+	if bytes.Compare(a[:], b[:]) < 0 {
+		return a, b
+	}
+	return b, a
+}
+
+func otherParticipant(conversation database.Conversation, userId uuid.UUID) uuid.UUID {
+	if conversation.UserAID == userId {
+		return conversation.UserBID
+	}
+	return conversation.UserAID
+}
+
+func messageToResponse(m database.Message) messageResponse {
+	return messageResponse{
+		ID:             m.ID,
+		CreatedAt:      m.CreatedAt,
+		ConversationID: m.ConversationID,
+		SenderID:       m.SenderID,
+		Body:           m.Body,
+		ReadAt:         nullTimePtr(m.ReadAt),
+	}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sam-maton/chirpy/internal/auth"
+	"github.com/sam-maton/chirpy/internal/database"
+)
+
+const (
+	totpIssuer        = "Chirpy"
+	recoveryCodeCount = 10
+)
+
+func (cfg *apiConfig) handlerEnrollTOTP(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	type response struct {
+		Secret     string `json:"secret"`
+		OTPAuthURI string `json:"otpauth_uri"`
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userId)
+	if err != nil {
+		respondWithError(w, "There was an error getting the user", http.StatusInternalServerError, err)
+		return
+	}
+
+	if user.TotpEnabled {
+		respondWithError(w, "Two-factor authentication is already enabled", http.StatusConflict, nil)
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		respondWithError(w, "There was an error generating the TOTP secret", http.StatusInternalServerError, err)
+		return
+	}
+
+	// The secret isn't active until it has been confirmed with a code, so
+	// enrolling again just replaces a pending secret.
+	err = cfg.db.SetUserTOTPSecret(r.Context(), database.SetUserTOTPSecretParams{
+		ID:         userId,
+		TotpSecret: sql.NullString{String: secret, Valid: true},
+	})
+	if err != nil {
+		respondWithError(w, "There was an error saving the TOTP secret", http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJson(w, 200, response{
+		Secret:     secret,
+		OTPAuthURI: auth.TOTPURI(totpIssuer, user.Email, secret),
+	})
+}
+
+func (cfg *apiConfig) handlerConfirmTOTP(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	type params struct {
+		Code string `json:"code"`
+	}
+
+	type response struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	p := params{}
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&p)
+	if err != nil {
+		respondWithError(w, paramsDecodeError, http.StatusBadRequest, err)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userId)
+	if err != nil {
+		respondWithError(w, "There was an error getting the user", http.StatusInternalServerError, err)
+		return
+	}
+
+	if user.TotpEnabled {
+		respondWithError(w, "Two-factor authentication is already enabled", http.StatusConflict, nil)
+		return
+	}
+
+	if !user.TotpSecret.Valid {
+		respondWithError(w, "Two-factor authentication has not been enrolled", http.StatusBadRequest, nil)
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(user.TotpSecret.String, p.Code, time.Now(), 0)
+	if !ok {
+		respondWithError(w, "Invalid two-factor code", http.StatusUnauthorized, nil)
+		return
+	}
+
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		respondWithError(w, "There was an error generating recovery codes", http.StatusInternalServerError, err)
+		return
+	}
+
+	err = cfg.enableTOTP(r.Context(), userId, step, codes)
+	if err != nil {
+		respondWithError(w, "There was an error enabling two-factor authentication", http.StatusInternalServerError, err)
+		return
+	}
+
+	// This is the only time the plain recovery codes are ever shown.
+	respondWithJson(w, 200, response{RecoveryCodes: codes})
+}
+
+// enableTOTP turns on two-factor authentication with the step of the code
+// that confirmed it already used.
+func (cfg *apiConfig) enableTOTP(ctx context.Context, userId uuid.UUID, step int64, recoveryCodes []string) error {
+	tx, err := cfg.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	qtx := cfg.db.WithTx(tx)
+
+	err = qtx.DeleteRecoveryCodesByUserID(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	for _, code := range recoveryCodes {
+		err = qtx.CreateRecoveryCode(ctx, database.CreateRecoveryCodeParams{
+			UserID:   userId,
+			CodeHash: auth.HashToken(code),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	err = qtx.EnableUserTOTP(ctx, database.EnableUserTOTPParams{
+		ID:           userId,
+		TotpLastStep: sql.NullInt64{Int64: step, Valid: true},
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (cfg *apiConfig) handlerDisableTOTP(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	type params struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	p := params{}
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&p)
+	if err != nil {
+		respondWithError(w, paramsDecodeError, http.StatusBadRequest, err)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userId)
+	if err != nil {
+		respondWithError(w, "There was an error getting the user", http.StatusInternalServerError, err)
+		return
+	}
+
+	if !user.TotpEnabled {
+		respondWithError(w, "Two-factor authentication is not enabled", http.StatusBadRequest, nil)
+		return
+	}
+
+	ok, err := cfg.verifySecondFactor(r.Context(), user, p.Code, p.RecoveryCode)
+	if err != nil {
+		respondWithError(w, "There was an error checking the two-factor code", http.StatusInternalServerError, err)
+		return
+	}
+	if !ok {
+		respondWithError(w, "Invalid two-factor code", http.StatusUnauthorized, nil)
+		return
+	}
+
+	err = cfg.db.DisableUserTOTP(r.Context(), userId)
+	if err != nil {
+		respondWithError(w, "There was an error disabling two-factor authentication", http.StatusInternalServerError, err)
+		return
+	}
+
+	err = cfg.db.DeleteRecoveryCodesByUserID(r.Context(), userId)
+	if err != nil {
+		respondWithError(w, "There was an error deleting the recovery codes", http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerLoginMFA is the second step of logging in for users with two-factor
+// authentication. It exchanges the MFA token from handlerLoginUser and a TOTP
+// or recovery code for a session. Each MFA token can only be exchanged once.
+func (cfg *apiConfig) handlerLoginMFA(w http.ResponseWriter, r *http.Request) {
+	type params struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	p := params{}
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&p)
+	if err != nil {
+		respondWithError(w, paramsDecodeError, http.StatusBadRequest, err)
+		return
+	}
+
+	mfaToken, err := auth.ValidateMFAToken(p.MFAToken, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, "Invalid or expired MFA token", http.StatusUnauthorized, err)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), mfaToken.UserID)
+	if err != nil {
+		respondWithError(w, "Invalid or expired MFA token", http.StatusUnauthorized, err)
+		return
+	}
+
+	// Wrong codes count as failed logins, so guessing codes is throttled the
+	// same way guessing passwords is.
+	retryAfter, err := cfg.loginRetryAfter(r, user.Email)
+	if err != nil {
+		respondWithError(w, "There was an error checking previous login attempts", http.StatusInternalServerError, err)
+		return
+	}
+	if retryAfter > 0 {
+		respondWithTooManyRequests(w, "Too many failed login attempts, try again later", retryAfter)
+		return
+	}
+
+	ok, err := cfg.verifySecondFactor(r.Context(), user, p.Code, p.RecoveryCode)
+	if err != nil {
+		respondWithError(w, "There was an error checking the two-factor code", http.StatusInternalServerError, err)
+		return
+	}
+	if !ok {
+		cfg.recordLoginAttempt(r, user.Email, uuid.NullUUID{UUID: user.ID, Valid: true}, false)
+		respondWithError(w, "Invalid two-factor code", http.StatusUnauthorized, nil)
+		return
+	}
+
+	err = cfg.db.DeleteExpiredMFATokens(r.Context())
+	if err != nil {
+		log.Printf("There was an error deleting expired MFA tokens: %s", err)
+	}
+
+	// The token is only used up once the code is right, so a mistyped code
+	// can be tried again.
+	used, err := cfg.db.UseMFAToken(r.Context(), database.UseMFATokenParams{
+		ID:        mfaToken.ID,
+		ExpiresAt: mfaToken.ExpiresAt,
+	})
+	if err != nil {
+		respondWithError(w, "There was an error using the MFA token", http.StatusInternalServerError, err)
+		return
+	}
+	if used == 0 {
+		respondWithError(w, "Invalid or expired MFA token", http.StatusUnauthorized, nil)
+		return
+	}
+
+	cfg.recordLoginAttempt(r, user.Email, uuid.NullUUID{UUID: user.ID, Valid: true}, true)
+	cfg.respondWithSession(w, r, user)
+}
+
+// verifySecondFactor checks a TOTP code and records its time step so it can't
+// be used again, or if none was given, uses up one of the user's recovery
+// codes.
+func (cfg *apiConfig) verifySecondFactor(ctx context.Context, user database.User, code, recoveryCode string) (bool, error) {
+	if !user.TotpEnabled || !user.TotpSecret.Valid {
+		return false, nil
+	}
+
+	if code != "" {
+		step, ok := auth.ValidateTOTP(user.TotpSecret.String, code, time.Now(), user.TotpLastStep.Int64)
+		if !ok {
+			return false, nil
+		}
+
+		used, err := cfg.db.UseTOTPStep(ctx, database.UseTOTPStepParams{
+			ID:           user.ID,
+			TotpLastStep: sql.NullInt64{Int64: step, Valid: true},
+		})
+		if err != nil {
+			return false, err
+		}
+		return used == 1, nil
+	}
+
+	if recoveryCode == "" {
+		return false, nil
+	}
+
+	used, err := cfg.db.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+		UserID:   user.ID,
+		CodeHash: auth.HashToken(strings.ToLower(strings.TrimSpace(recoveryCode))),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return used == 1, nil
+}
@@ -1,13 +1,24 @@
 package main
 
 import (
+	"log"
 	"net/http"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/sam-maton/chirpy/internal/auth"
 )
 
-func (cfg *apiConfig) middlewareAuth(handler func(http.ResponseWriter, *http.Request, uuid.UUID)) func(http.ResponseWriter, *http.Request) {
+// sessionOnly is passed to middlewareAuth for routes that can't be used with
+// a personal API token at all, only with a JWT from logging in.
+const sessionOnly auth.Scope = ""
+
+// middlewareAuth accepts either a JWT or a personal API token. API tokens are
+// only allowed through if they were granted the route's scope. Tokens of
+// suspended or banned users are rejected even if they haven't expired.
+func (cfg *apiConfig) middlewareAuth(scope auth.Scope, handler func(http.ResponseWriter, *http.Request, uuid.UUID)) func(http.ResponseWriter, *http.Request) {
+	handler = cfg.requireActiveAccount(handler)
+
 	return func(w http.ResponseWriter, r *http.Request) {
 		token, err := auth.GetBearerToken(r.Header)
 		if err != nil {
@@ -15,6 +26,11 @@ func (cfg *apiConfig) middlewareAuth(handler func(http.ResponseWriter, *http.Req
 			return
 		}
 
+		if auth.IsAPIToken(token) {
+			cfg.authenticateAPIToken(w, r, token, scope, handler)
+			return
+		}
+
 		userId, err := auth.ValidateJWT(token, cfg.jwtSecret)
 		if err != nil {
 			respondWithError(w, "Invalid auth token", http.StatusUnauthorized, err)
@@ -24,3 +40,62 @@ func (cfg *apiConfig) middlewareAuth(handler func(http.ResponseWriter, *http.Req
 		handler(w, r, userId)
 	}
 }
+
+// middlewareOptionalAuth is for routes that anyone can use but that change
+// what they return for a signed in user. Requests without an Authorization
+// header get an invalid user ID; requests with a bad one are still rejected.
+func (cfg *apiConfig) middlewareOptionalAuth(scope auth.Scope, handler func(http.ResponseWriter, *http.Request, uuid.NullUUID)) func(http.ResponseWriter, *http.Request) {
+	authenticated := cfg.middlewareAuth(scope, func(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+		handler(w, r, uuid.NullUUID{UUID: userId, Valid: true})
+	})
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			handler(w, r, uuid.NullUUID{})
+			return
+		}
+		authenticated(w, r)
+	}
+}
+
+func (cfg *apiConfig) authenticateAPIToken(w http.ResponseWriter, r *http.Request, token string, scope auth.Scope, handler func(http.ResponseWriter, *http.Request, uuid.UUID)) {
+	apiToken, err := cfg.db.GetAPITokenByHash(r.Context(), auth.HashToken(token))
+	if err != nil {
+		respondWithError(w, "Invalid API token", http.StatusUnauthorized, err)
+		return
+	}
+
+	if apiToken.RevokedAt.Valid || (apiToken.ExpiresAt.Valid && time.Now().After(apiToken.ExpiresAt.Time)) {
+		respondWithError(w, "The API token has expired or been revoked", http.StatusUnauthorized, nil)
+		return
+	}
+
+	if scope == sessionOnly || !auth.HasScope(apiToken.Scopes, scope) {
+		respondWithError(w, "The API token does not have the required scope", http.StatusForbidden, nil)
+		return
+	}
+
+	err = cfg.db.TouchAPIToken(r.Context(), apiToken.ID)
+	if err != nil {
+		log.Printf("There was an error updating the API token's last use: %s", err)
+	}
+
+	handler(w, r, apiToken.UserID)
+}
+
+func (cfg *apiConfig) middlewareRequireRole(role auth.Role, handler func(http.ResponseWriter, *http.Request, uuid.UUID)) func(http.ResponseWriter, *http.Request) {
+	return cfg.middlewareAuth(sessionOnly, func(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+		user, err := cfg.db.GetUserByID(r.Context(), userId)
+		if err != nil {
+			respondWithError(w, "Invalid auth token", http.StatusUnauthorized, err)
+			return
+		}
+
+		if !auth.Role(user.Role).Satisfies(role) {
+			respondWithError(w, "User does not have permission to access this resource", http.StatusForbidden, nil)
+			return
+		}
+
+		handler(w, r, userId)
+	})
+}
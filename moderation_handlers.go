@@ -0,0 +1,398 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sam-maton/chirpy/internal/auth"
+	"github.com/sam-maton/chirpy/internal/database"
+)
+
+const (
+	actionHideChirp     = "hide_chirp"
+	actionSuspendUser   = "suspend_user"
+	actionBanUser       = "ban_user"
+	actionUnsuspendUser = "unsuspend_user"
+	actionDismiss       = "dismiss"
+
+	defaultSuspensionDays = 7
+	maxSuspensionDays     = 365
+	maxReportDetailsChars = 1000
+)
+
+var reportReasons = []string{"spam", "harassment", "hate", "violence", "misinformation", "other"}
+
+var reportStatuses = []string{"open", "resolved", "dismissed"}
+
+var (
+	errReportAlreadyResolved = errors.New("report has already been resolved")
+	errCannotSuspendStaff    = errors.New("moderators and admins can't be suspended from the queue")
+	errInvalidAction         = errors.New("invalid moderation action")
+)
+
+type reportResponse struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ChirpID    uuid.UUID  `json:"chirp_id"`
+	ReporterID *uuid.UUID `json:"reporter_id"`
+	Reason     string     `json:"reason"`
+	Details    *string    `json:"details"`
+	Status     string     `json:"status"`
+	ResolvedAt *time.Time `json:"resolved_at"`
+	ResolvedBy *uuid.UUID `json:"resolved_by"`
+}
+
+type moderationActionResponse struct {
+	ID              uuid.UUID  `json:"id"`
+	CreatedAt       time.Time  `json:"created_at"`
+	ModeratorID     *uuid.UUID `json:"moderator_id"`
+	Action          string     `json:"action"`
+	ChirpID         *uuid.UUID `json:"chirp_id"`
+	TargetUserID    *uuid.UUID `json:"target_user_id"`
+	Note            *string    `json:"note"`
+	ReportsResolved int32      `json:"reports_resolved"`
+}
+
+// MODERATION HANDLERS
+func (cfg *apiConfig) handlerReportChirp(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	type params struct {
+		Reason  string `json:"reason"`
+		Details string `json:"details"`
+	}
+
+	chirpId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, "Not a valid ID", http.StatusBadRequest, err)
+		return
+	}
+
+	p := params{}
+	decoder := json.NewDecoder(r.Body)
+	err = decoder.Decode(&p)
+	if err != nil {
+		respondWithError(w, paramsDecodeError, http.StatusBadRequest, err)
+		return
+	}
+
+	if !slices.Contains(reportReasons, p.Reason) {
+		respondWithError(w, "Reason must be one of "+strings.Join(reportReasons, ", "), http.StatusBadRequest, nil)
+		return
+	}
+	if len([]rune(p.Details)) > maxReportDetailsChars {
+		respondWithError(w, "Details are too long", http.StatusBadRequest, nil)
+		return
+	}
+
+	chirp, err := cfg.db.GetChirpByID(r.Context(), chirpId)
+	if err != nil || chirp.HiddenAt.Valid || chirp.ShadowHiddenAt.Valid || chirp.Status == chirpStatusScheduled {
+		respondWithError(w, "Chirp could not be found", http.StatusNotFound, err)
+		return
+	}
+
+	if chirp.UserID == userId {
+		respondWithError(w, "You can't report your own Chirp", http.StatusBadRequest, nil)
+		return
+	}
+
+	report, err := cfg.db.CreateReport(r.Context(), database.CreateReportParams{
+		ChirpID:    chirpId,
+		ReporterID: uuid.NullUUID{UUID: userId, Valid: true},
+		Reason:     p.Reason,
+		Details:    sql.NullString{String: p.Details, Valid: p.Details != ""},
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, "You have already reported this Chirp", http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, "There was an error saving the report", http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJson(w, 201, reportToResponse(report))
+}
+
+func (cfg *apiConfig) handlerGetReports(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	type response struct {
+		reportResponse
+		ChirpBody           string     `json:"chirp_body"`
+		ChirpUserID         uuid.UUID  `json:"chirp_user_id"`
+		ChirpHiddenAt       *time.Time `json:"chirp_hidden_at"`
+		ChirpShadowHiddenAt *time.Time `json:"chirp_shadow_hidden_at"`
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = "open"
+	}
+	if !slices.Contains(reportStatuses, status) {
+		respondWithError(w, "Status must be one of "+strings.Join(reportStatuses, ", "), http.StatusBadRequest, nil)
+		return
+	}
+
+	reports, err := cfg.db.GetReportsByStatus(r.Context(), database.GetReportsByStatusParams{
+		Status: status,
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		respondWithError(w, "There was an error getting the reports", http.StatusInternalServerError, err)
+		return
+	}
+
+	res := []response{}
+	for _, report := range reports {
+		res = append(res, response{
+			reportResponse: reportResponse{
+				ID:         report.ID,
+				CreatedAt:  report.CreatedAt,
+				ChirpID:    report.ChirpID,
+				ReporterID: nullUUIDPtr(report.ReporterID),
+				Reason:     report.Reason,
+				Details:    nullStringPtr(report.Details),
+				Status:     report.Status,
+				ResolvedAt: nullTimePtr(report.ResolvedAt),
+				ResolvedBy: nullUUIDPtr(report.ResolvedBy),
+			},
+			ChirpBody:           report.ChirpBody,
+			ChirpUserID:         report.ChirpUserID,
+			ChirpHiddenAt:       nullTimePtr(report.ChirpHiddenAt),
+			ChirpShadowHiddenAt: nullTimePtr(report.ChirpShadowHiddenAt),
+		})
+	}
+
+	respondWithJson(w, 200, res)
+}
+
+func (cfg *apiConfig) handlerResolveReport(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	type params struct {
+		Action      string `json:"action"`
+		Note        string `json:"note"`
+		SuspendDays int    `json:"suspend_days"`
+	}
+
+	reportId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, "Not a valid ID", http.StatusBadRequest, err)
+		return
+	}
+
+	p := params{}
+	decoder := json.NewDecoder(r.Body)
+	err = decoder.Decode(&p)
+	if err != nil {
+		respondWithError(w, paramsDecodeError, http.StatusBadRequest, err)
+		return
+	}
+
+	if p.SuspendDays == 0 {
+		p.SuspendDays = defaultSuspensionDays
+	}
+	if p.SuspendDays < 1 || p.SuspendDays > maxSuspensionDays {
+		respondWithError(w, "suspend_days must be between 1 and 365", http.StatusBadRequest, nil)
+		return
+	}
+
+	report, err := cfg.db.GetReportByID(r.Context(), reportId)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, "Report could not be found", http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, "There was an error getting the report", http.StatusInternalServerError, err)
+		return
+	}
+
+	action, chirp, err := cfg.applyModerationAction(r.Context(), userId, report, p.Action, p.Note, time.Now().AddDate(0, 0, p.SuspendDays))
+	switch {
+	case errors.Is(err, errInvalidAction):
+		respondWithError(w, "Action must be one of hide_chirp, suspend_user or dismiss", http.StatusBadRequest, err)
+		return
+	case errors.Is(err, errReportAlreadyResolved):
+		respondWithError(w, "Report has already been resolved", http.StatusConflict, err)
+		return
+	case errors.Is(err, errCannotSuspendStaff):
+		respondWithError(w, "Moderators and admins can't be suspended from the moderation queue", http.StatusForbidden, err)
+		return
+	case err != nil:
+		respondWithError(w, "There was an error resolving the report", http.StatusInternalServerError, err)
+		return
+	}
+
+	switch action.Action {
+	case actionHideChirp:
+		cfg.publishChirpDeleted(r.Context(), chirp)
+	case actionSuspendUser:
+		cfg.publishUserUpdated(r.Context(), chirp.UserID)
+	case actionDismiss:
+		// A chirp the spam checks shadow hid was never announced, so it is
+		// announced now that it has been released.
+		if chirp.ShadowHiddenAt.Valid && !chirp.HiddenAt.Valid && chirp.Status == chirpStatusPublished {
+			chirp.ShadowHiddenAt = sql.NullTime{}
+			responses, err := cfg.chirpsToResponse(r.Context(), []database.Chirp{chirp}, uuid.NullUUID{})
+			if err != nil {
+				log.Printf("There was an error announcing released chirp %s: %s", chirp.ID, err)
+			} else {
+				cfg.afterChirpPublished(r.Context(), chirp, responses[0])
+			}
+		}
+	}
+
+	respondWithJson(w, 200, moderationActionToResponse(action))
+}
+
+func (cfg *apiConfig) handlerGetModerationActions(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	actions, err := cfg.db.GetModerationActions(r.Context(), database.GetModerationActionsParams{
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		respondWithError(w, "There was an error getting the moderation actions", http.StatusInternalServerError, err)
+		return
+	}
+
+	response := []moderationActionResponse{}
+	for _, a := range actions {
+		response = append(response, moderationActionToResponse(a))
+	}
+
+	respondWithJson(w, 200, response)
+}
+
+// applyModerationAction carries out a moderator's decision on a report,
+// settles every open report about the same chirp and records the decision,
+// all in one transaction.
+func (cfg *apiConfig) applyModerationAction(ctx context.Context, moderatorId uuid.UUID, report database.Report, action, note string, suspendUntil time.Time) (database.ModerationAction, database.Chirp, error) {
+	if !slices.Contains([]string{actionHideChirp, actionSuspendUser, actionDismiss}, action) {
+		return database.ModerationAction{}, database.Chirp{}, errInvalidAction
+	}
+	if report.Status != "open" {
+		return database.ModerationAction{}, database.Chirp{}, errReportAlreadyResolved
+	}
+
+	tx, err := cfg.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return database.ModerationAction{}, database.Chirp{}, err
+	}
+	defer tx.Rollback()
+
+	qtx := cfg.db.WithTx(tx)
+
+	chirp, err := qtx.GetChirpByID(ctx, report.ChirpID)
+	if err != nil {
+		return database.ModerationAction{}, database.Chirp{}, err
+	}
+
+	status := "resolved"
+	if action == actionDismiss {
+		status = "dismissed"
+	}
+
+	// The reports are settled before anything else so that if two
+	// moderators decide at once, the second waits for the first and then
+	// finds nothing left to resolve.
+	resolved, err := qtx.ResolveReportsForChirp(ctx, database.ResolveReportsForChirpParams{
+		ChirpID:    chirp.ID,
+		Status:     status,
+		ResolvedBy: uuid.NullUUID{UUID: moderatorId, Valid: true},
+	})
+	if err != nil {
+		return database.ModerationAction{}, database.Chirp{}, err
+	}
+	if resolved == 0 {
+		return database.ModerationAction{}, database.Chirp{}, errReportAlreadyResolved
+	}
+
+	targetUser := uuid.NullUUID{}
+
+	switch action {
+	case actionHideChirp:
+		err = qtx.HideChirp(ctx, chirp.ID)
+	case actionSuspendUser:
+		var author database.User
+		author, err = qtx.GetUserByID(ctx, chirp.UserID)
+		if err != nil {
+			return database.ModerationAction{}, database.Chirp{}, err
+		}
+		if auth.Role(author.Role).Satisfies(auth.RoleModerator) {
+			return database.ModerationAction{}, database.Chirp{}, errCannotSuspendStaff
+		}
+
+		targetUser = uuid.NullUUID{UUID: author.ID, Valid: true}
+		err = qtx.SuspendUser(ctx, database.SuspendUserParams{
+			ID:               author.ID,
+			SuspendedUntil:   sql.NullTime{Time: suspendUntil, Valid: true},
+			SuspensionReason: sql.NullString{String: note, Valid: note != ""},
+		})
+	case actionDismiss:
+		// Dismissing a report raised by the spam checks releases the chirp
+		// if they shadow hid it.
+		if chirp.ShadowHiddenAt.Valid {
+			err = qtx.ClearChirpShadowHidden(ctx, chirp.ID)
+		}
+	}
+	if err != nil {
+		return database.ModerationAction{}, database.Chirp{}, err
+	}
+
+	moderationAction, err := qtx.CreateModerationAction(ctx, database.CreateModerationActionParams{
+		ModeratorID:     uuid.NullUUID{UUID: moderatorId, Valid: true},
+		Action:          action,
+		ChirpID:         uuid.NullUUID{UUID: chirp.ID, Valid: true},
+		TargetUserID:    targetUser,
+		Note:            sql.NullString{String: note, Valid: note != ""},
+		ReportsResolved: int32(resolved),
+	})
+	if err != nil {
+		return database.ModerationAction{}, database.Chirp{}, err
+	}
+
+	return moderationAction, chirp, tx.Commit()
+}
+
+func reportToResponse(r database.Report) reportResponse {
+	return reportResponse{
+		ID:         r.ID,
+		CreatedAt:  r.CreatedAt,
+		ChirpID:    r.ChirpID,
+		ReporterID: nullUUIDPtr(r.ReporterID),
+		Reason:     r.Reason,
+		Details:    nullStringPtr(r.Details),
+		Status:     r.Status,
+		ResolvedAt: nullTimePtr(r.ResolvedAt),
+		ResolvedBy: nullUUIDPtr(r.ResolvedBy),
+	}
+}
+
+func moderationActionToResponse(a database.ModerationAction) moderationActionResponse {
+	return moderationActionResponse{
+		ID:              a.ID,
+		CreatedAt:       a.CreatedAt,
+		ModeratorID:     nullUUIDPtr(a.ModeratorID),
+		Action:          a.Action,
+		ChirpID:         nullUUIDPtr(a.ChirpID),
+		TargetUserID:    nullUUIDPtr(a.TargetUserID),
+		Note:            nullStringPtr(a.Note),
+		ReportsResolved: a.ReportsResolved,
+	}
+}
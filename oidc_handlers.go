@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sam-maton/chirpy/internal/database"
+	"github.com/sam-maton/chirpy/internal/oidc"
+)
+
+const oidcLoginStateTTL = 10 * time.Minute
+
+var errOIDCEmailNotVerified = errors.New("identity provider did not return a verified email")
+
+// handlerOIDCLogin starts an authorization code login by redirecting the user
+// to the identity provider.
+func (cfg *apiConfig) handlerOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if cfg.oidcProvider == nil {
+		respondWithError(w, "OIDC login is not configured", http.StatusNotFound, nil)
+		return
+	}
+
+	state, err := oidc.RandomString()
+	if err != nil {
+		respondWithError(w, "There was an error starting the login", http.StatusInternalServerError, err)
+		return
+	}
+	codeVerifier, err := oidc.RandomString()
+	if err != nil {
+		respondWithError(w, "There was an error starting the login", http.StatusInternalServerError, err)
+		return
+	}
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		respondWithError(w, "There was an error starting the login", http.StatusInternalServerError, err)
+		return
+	}
+
+	err = cfg.db.DeleteExpiredOIDCLoginStates(r.Context())
+	if err != nil {
+		log.Printf("There was an error deleting expired OIDC login states: %s", err)
+	}
+
+	err = cfg.db.CreateOIDCLoginState(r.Context(), database.CreateOIDCLoginStateParams{
+		State:        state,
+		ExpiresAt:    time.Now().Add(oidcLoginStateTTL),
+		CodeVerifier: codeVerifier,
+		Nonce:        nonce,
+	})
+	if err != nil {
+		respondWithError(w, "There was an error starting the login", http.StatusInternalServerError, err)
+		return
+	}
+
+	authURL, err := cfg.oidcProvider.AuthCodeURL(r.Context(), state, oidc.CodeChallenge(codeVerifier), nonce)
+	if err != nil {
+		respondWithError(w, "There was an error contacting the identity provider", http.StatusBadGateway, err)
+		return
+	}
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// handlerOIDCCallback is where the identity provider sends the user back to.
+// On success it logs the user in exactly like a password login would.
+func (cfg *apiConfig) handlerOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if cfg.oidcProvider == nil {
+		respondWithError(w, "OIDC login is not configured", http.StatusNotFound, nil)
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Get("error") != "" {
+		respondWithError(w, "The identity provider rejected the login", http.StatusUnauthorized, errors.New(query.Get("error")))
+		return
+	}
+
+	loginState, err := cfg.db.ConsumeOIDCLoginState(r.Context(), query.Get("state"))
+	if err != nil || time.Now().After(loginState.ExpiresAt) {
+		respondWithError(w, "Invalid or expired login state", http.StatusBadRequest, err)
+		return
+	}
+
+	identity, err := cfg.oidcProvider.Exchange(r.Context(), query.Get("code"), loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		respondWithError(w, "The login could not be verified", http.StatusUnauthorized, err)
+		return
+	}
+
+	user, err := cfg.getOrCreateOIDCUser(r.Context(), identity)
+	if errors.Is(err, errOIDCEmailNotVerified) {
+		respondWithError(w, "The identity provider did not return a verified email", http.StatusForbidden, err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, "There was an error linking the identity to a user", http.StatusInternalServerError, err)
+		return
+	}
+
+	// Logins through the identity provider are audited like password logins.
+	// As there, a login that still needs a second factor is recorded once
+	// the code has been checked.
+	userId := uuid.NullUUID{UUID: user.ID, Valid: true}
+	status := accountStatusFromUser(user)
+	if status.disabled(time.Now()) {
+		cfg.recordLoginAttempt(r, user.Email, userId, false)
+		rejectDisabledAccount(w, status)
+		return
+	}
+
+	if user.TotpEnabled {
+		cfg.respondWithMFAChallenge(w, user)
+		return
+	}
+
+	cfg.recordLoginAttempt(r, user.Email, userId, true)
+	cfg.respondWithSession(w, r, user)
+}
+
+// getOrCreateOIDCUser returns the user linked to an external identity. New
+// identities are linked to the user with the same email, or to a new user
+// without a password if there isn't one. Only verified emails are trusted for
+// this, otherwise anyone could claim someone else's account.
+func (cfg *apiConfig) getOrCreateOIDCUser(ctx context.Context, identity oidc.Identity) (database.User, error) {
+	user, err := cfg.db.GetUserByIdentity(ctx, database.GetUserByIdentityParams{
+		Provider: cfg.oidcProviderName,
+		Subject:  identity.Subject,
+	})
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, err
+	}
+
+	if identity.Email == "" || !identity.EmailVerified {
+		return database.User{}, errOIDCEmailNotVerified
+	}
+
+	tx, err := cfg.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return database.User{}, err
+	}
+	defer tx.Rollback()
+
+	qtx := cfg.db.WithTx(tx)
+
+	user, err = qtx.GetUserByEmail(ctx, identity.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		created, createErr := qtx.CreateUser(ctx, database.CreateUserParams{
+			Email:          identity.Email,
+			HashedPassword: "",
+		})
+		if createErr != nil {
+			return database.User{}, createErr
+		}
+		user, err = qtx.GetUserByID(ctx, created.ID)
+	}
+	if err != nil {
+		return database.User{}, err
+	}
+
+	_, err = qtx.CreateUserIdentity(ctx, database.CreateUserIdentityParams{
+		UserID:   user.ID,
+		Provider: cfg.oidcProviderName,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+
+	return user, tx.Commit()
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sam-maton/chirpy/internal/database"
+	"github.com/sam-maton/chirpy/internal/netguard"
+	"github.com/sam-maton/chirpy/internal/webhooks"
+)
+
+const (
+	webhookDispatchInterval = 5 * time.Second
+	webhookDispatchBatch    = 20
+)
+
+// enqueueWebhookEvent queues a delivery of the event for every subscription
+// that wants it. It takes the queries to use so events caused by a
+// transaction are only queued if the transaction commits.
+func (cfg *apiConfig) enqueueWebhookEvent(ctx context.Context, q *database.Queries, userId uuid.UUID, event string, data any) error {
+	subscriptionIds, err := q.GetWebhookSubscriptionsForEvent(ctx, database.GetWebhookSubscriptionsForEventParams{
+		UserID:    userId,
+		EventType: event,
+	})
+	if err != nil || len(subscriptionIds) == 0 {
+		return err
+	}
+
+	payload, err := webhooks.NewPayload(event, data, time.Now())
+	if err != nil {
+		return err
+	}
+
+	for _, id := range subscriptionIds {
+		err = q.CreateWebhookDelivery(ctx, database.CreateWebhookDeliveryParams{
+			SubscriptionID: id,
+			EventType:      event,
+			Payload:        payload,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publishWebhookEvent queues an event outside of a transaction. Failing to
+// queue a webhook shouldn't fail the request that caused it, so errors are
+// only logged.
+func (cfg *apiConfig) publishWebhookEvent(ctx context.Context, userId uuid.UUID, event string, data any) {
+	err := cfg.enqueueWebhookEvent(ctx, cfg.db, userId, event, data)
+	if err != nil {
+		log.Printf("There was an error queueing the %s webhook: %s", event, err)
+	}
+}
+
+// runWebhookDispatcher sends queued deliveries until ctx is cancelled. Any
+// number of servers can run it against the same database.
+func (cfg *apiConfig) runWebhookDispatcher(ctx context.Context) {
+	ticker := time.NewTicker(webhookDispatchInterval)
+	defer ticker.Stop()
+
+	for {
+		cfg.dispatchWebhookDeliveries(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (cfg *apiConfig) dispatchWebhookDeliveries(ctx context.Context) {
+	deliveries, err := cfg.db.ClaimWebhookDeliveries(ctx, webhookDispatchBatch)
+	if err != nil {
+		log.Printf("There was an error claiming webhook deliveries: %s", err)
+		return
+	}
+
+	for _, d := range deliveries {
+		// Events queued before the owner was demoted, suspended or banned
+		// aren't sent either.
+		if !d.OwnerAllowed {
+			err = cfg.db.MarkWebhookDeliveryFailed(ctx, database.MarkWebhookDeliveryFailedParams{
+				ID:            d.ID,
+				Status:        "failed",
+				NextAttemptAt: time.Now(),
+				LastError:     sql.NullString{String: "the webhook's owner can no longer receive this event", Valid: true},
+			})
+			if err != nil {
+				log.Printf("There was an error recording webhook delivery %s: %s", d.ID, err)
+			}
+			continue
+		}
+
+		status, sendErr := cfg.webhookSender.Send(ctx, webhooks.Delivery{
+			ID:      d.ID.String(),
+			Event:   d.EventType,
+			URL:     d.Url,
+			Secret:  d.Secret,
+			Payload: d.Payload,
+		})
+		responseStatus := sql.NullInt32{Int32: int32(status), Valid: status != 0}
+
+		if sendErr == nil {
+			err = cfg.db.MarkWebhookDeliveryDelivered(ctx, database.MarkWebhookDeliveryDeliveredParams{
+				ID:             d.ID,
+				ResponseStatus: responseStatus,
+			})
+		} else {
+			deliveryStatus := "pending"
+			// A blocked address won't become public by trying again.
+			if d.Attempts >= webhooks.MaxAttempts || errors.Is(sendErr, netguard.ErrBlockedAddress) {
+				deliveryStatus = "failed"
+			}
+
+			err = cfg.db.MarkWebhookDeliveryFailed(ctx, database.MarkWebhookDeliveryFailedParams{
+				ID:             d.ID,
+				Status:         deliveryStatus,
+				NextAttemptAt:  time.Now().Add(webhooks.Backoff(int(d.Attempts))),
+				ResponseStatus: responseStatus,
+				LastError:      sql.NullString{String: sendErr.Error(), Valid: true},
+			})
+		}
+		if err != nil {
+			log.Printf("There was an error recording webhook delivery %s: %s", d.ID, err)
+		}
+	}
+}
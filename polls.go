@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/sam-maton/chirpy/internal/database"
+)
+
+const (
+	minPollOptions      = 2
+	maxPollOptions      = 4
+	maxPollOptionChars  = 80
+	defaultPollDuration = 24 * time.Hour
+	minPollDuration     = 5 * time.Minute
+	maxPollDuration     = 7 * 24 * time.Hour
+)
+
+var errInvalidPoll = errors.New("invalid poll")
+
+// newPoll is a poll to be created with a chirp. It has no options if the
+// chirp has no poll.
+type newPoll struct {
+	Options  []string
+	ClosesAt time.Time
+}
+
+type pollResponse struct {
+	ClosesAt time.Time            `json:"closes_at"`
+	Closed   bool                 `json:"closed"`
+	Options  []pollOptionResponse `json:"options"`
+	// Vote counts are null until the viewer has voted or the poll has
+	// closed, so earlier votes don't sway later ones.
+	TotalVotes  *int64 `json:"total_votes"`
+	VotedOption *int32 `json:"voted_option"`
+}
+
+type pollOptionResponse struct {
+	Position int32  `json:"position"`
+	Text     string `json:"text"`
+	Votes    *int64 `json:"votes"`
+}
+
+// parsePoll checks the poll options and closing time sent with a new chirp.
+// Options are trimmed, and the poll closes after defaultPollDuration if no
+// closing time was given. Problems are wrapped in errInvalidPoll.
+func parsePoll(options []string, closesAt *time.Time, now time.Time) (newPoll, error) {
+	if len(options) == 0 {
+		if closesAt != nil {
+			return newPoll{}, fmt.Errorf("%w: a closing time was given without any options", errInvalidPoll)
+		}
+		return newPoll{}, nil
+	}
+
+	if len(options) < minPollOptions || len(options) > maxPollOptions {
+		return newPoll{}, fmt.Errorf("%w: a poll needs between %d and %d options", errInvalidPoll, minPollOptions, maxPollOptions)
+	}
+
+	poll := newPoll{ClosesAt: now.Add(defaultPollDuration)}
+	for _, option := range options {
+		option = strings.TrimSpace(option)
+		if option == "" || utf8.RuneCountInString(option) > maxPollOptionChars {
+			return newPoll{}, fmt.Errorf("%w: options must be between 1 and %d characters", errInvalidPoll, maxPollOptionChars)
+		}
+		for _, existing := range poll.Options {
+			if strings.EqualFold(existing, option) {
+				return newPoll{}, fmt.Errorf("%w: options must be different from each other", errInvalidPoll)
+			}
+		}
+		poll.Options = append(poll.Options, option)
+	}
+
+	if closesAt != nil {
+		duration := closesAt.Sub(now)
+		if duration < minPollDuration || duration > maxPollDuration {
+			return newPoll{}, fmt.Errorf("%w: a poll must close between %d minutes and %d days from now", errInvalidPoll, int(minPollDuration.Minutes()), int(maxPollDuration.Hours()/24))
+		}
+		poll.ClosesAt = *closesAt
+	}
+
+	return poll, nil
+}
+
+// createPoll saves a new chirp's poll. Nothing is saved if it has no
+// options.
+func createPoll(ctx context.Context, q *database.Queries, chirpId uuid.UUID, p newPoll) (*pollResponse, error) {
+	if len(p.Options) == 0 {
+		return nil, nil
+	}
+
+	poll, err := q.CreatePoll(ctx, database.CreatePollParams{
+		ChirpID:  chirpId,
+		ClosesAt: p.ClosesAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	results := []database.GetPollResultsByChirpIDsRow{}
+	for i, text := range p.Options {
+		err = q.CreatePollOption(ctx, database.CreatePollOptionParams{
+			ChirpID:  chirpId,
+			Position: int32(i),
+			Text:     text,
+		})
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, database.GetPollResultsByChirpIDsRow{ChirpID: chirpId, Position: int32(i), Text: text})
+	}
+
+	return pollToResponse(poll, results, nil, time.Now()), nil
+}
+
+func pollToResponse(poll database.Poll, results []database.GetPollResultsByChirpIDsRow, votedOption *int32, now time.Time) *pollResponse {
+	response := &pollResponse{
+		ClosesAt:    poll.ClosesAt,
+		Closed:      !now.Before(poll.ClosesAt),
+		Options:     []pollOptionResponse{},
+		VotedOption: votedOption,
+	}
+	showResults := response.Closed || votedOption != nil
+
+	total := int64(0)
+	for _, r := range results {
+		option := pollOptionResponse{Position: r.Position, Text: r.Text}
+		if showResults {
+			votes := r.Votes
+			option.Votes = &votes
+		}
+		response.Options = append(response.Options, option)
+		total += r.Votes
+	}
+	if showResults {
+		response.TotalVotes = &total
+	}
+
+	return response
+}
+
+// pollsByChirp loads the polls of all the chirps, with results as the
+// viewer is allowed to see them, in one query each.
+func (cfg *apiConfig) pollsByChirp(ctx context.Context, chirpIds []uuid.UUID, viewer uuid.NullUUID) (map[uuid.UUID]*pollResponse, error) {
+	polls, err := cfg.db.GetPollsByChirpIDs(ctx, chirpIds)
+	if err != nil || len(polls) == 0 {
+		return map[uuid.UUID]*pollResponse{}, err
+	}
+
+	pollIds := []uuid.UUID{}
+	for _, p := range polls {
+		pollIds = append(pollIds, p.ChirpID)
+	}
+
+	results, err := cfg.db.GetPollResultsByChirpIDs(ctx, pollIds)
+	if err != nil {
+		return nil, err
+	}
+	resultsByPoll := map[uuid.UUID][]database.GetPollResultsByChirpIDsRow{}
+	for _, r := range results {
+		resultsByPoll[r.ChirpID] = append(resultsByPoll[r.ChirpID], r)
+	}
+
+	votes := map[uuid.UUID]*int32{}
+	if viewer.Valid {
+		rows, err := cfg.db.GetPollVotesByUser(ctx, database.GetPollVotesByUserParams{
+			UserID:   viewer.UUID,
+			ChirpIds: pollIds,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range rows {
+			position := v.Position
+			votes[v.ChirpID] = &position
+		}
+	}
+
+	now := time.Now()
+	byChirp := map[uuid.UUID]*pollResponse{}
+	for _, p := range polls {
+		byChirp[p.ChirpID] = pollToResponse(p, resultsByPoll[p.ChirpID], votes[p.ChirpID], now)
+	}
+	return byChirp, nil
+}
+
+// POLL HANDLERS
+func (cfg *apiConfig) handlerVotePoll(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	type params struct {
+		Option *int32 `json:"option"`
+	}
+
+	chirpId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, "Not a valid ID", http.StatusBadRequest, err)
+		return
+	}
+
+	p := params{}
+	err = json.NewDecoder(r.Body).Decode(&p)
+	if err != nil {
+		respondWithError(w, paramsDecodeError, http.StatusBadRequest, err)
+		return
+	}
+	if p.Option == nil {
+		respondWithError(w, "An option must be chosen", http.StatusBadRequest, nil)
+		return
+	}
+
+	viewer := uuid.NullUUID{UUID: userId, Valid: true}
+
+	chirp, err := cfg.db.GetChirpByID(r.Context(), chirpId)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, "Chirp could not be found", http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, "There was an error getting the chirp", http.StatusInternalServerError, err)
+		return
+	}
+
+	visible, err := cfg.chirpVisibleTo(r.Context(), viewer, chirp)
+	if err != nil {
+		respondWithError(w, "There was an error getting the chirp's author", http.StatusInternalServerError, err)
+		return
+	}
+	if !visible {
+		respondWithError(w, "Chirp could not be found", http.StatusNotFound, nil)
+		return
+	}
+
+	// Users who have blocked each other can't interact, so to them the
+	// chirp isn't there.
+	if chirp.UserID != userId {
+		blocked, err := cfg.db.IsBlockedBetween(r.Context(), database.IsBlockedBetweenParams{
+			UserID:      userId,
+			OtherUserID: chirp.UserID,
+		})
+		if err != nil {
+			respondWithError(w, "There was an error checking blocked users", http.StatusInternalServerError, err)
+			return
+		}
+		if blocked {
+			respondWithError(w, "Chirp could not be found", http.StatusNotFound, nil)
+			return
+		}
+	}
+
+	poll, err := cfg.db.GetPoll(r.Context(), chirpId)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, "This chirp doesn't have a poll", http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, "There was an error getting the poll", http.StatusInternalServerError, err)
+		return
+	}
+
+	if chirp.Status == chirpStatusScheduled {
+		respondWithError(w, "This poll opens when the chirp is published", http.StatusConflict, nil)
+		return
+	}
+
+	if !time.Now().Before(poll.ClosesAt) {
+		respondWithError(w, "This poll has closed", http.StatusConflict, nil)
+		return
+	}
+
+	options, err := cfg.db.GetPollResultsByChirpIDs(r.Context(), []uuid.UUID{chirpId})
+	if err != nil {
+		respondWithError(w, "There was an error getting the poll", http.StatusInternalServerError, err)
+		return
+	}
+	if *p.Option < 0 || int(*p.Option) >= len(options) {
+		respondWithError(w, "Not a valid option", http.StatusBadRequest, nil)
+		return
+	}
+
+	voted, err := cfg.db.CreatePollVote(r.Context(), database.CreatePollVoteParams{
+		ChirpID:  chirpId,
+		UserID:   userId,
+		Position: *p.Option,
+	})
+	if err != nil {
+		respondWithError(w, "There was an error saving the vote", http.StatusInternalServerError, err)
+		return
+	}
+	if voted == 0 {
+		respondWithError(w, "You have already voted in this poll", http.StatusConflict, nil)
+		return
+	}
+
+	cfg.respondWithChirp(w, r, 200, chirp, viewer)
+}
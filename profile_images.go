@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/sam-maton/chirpy/internal/database"
+	"github.com/sam-maton/chirpy/internal/imaging"
+)
+
+const (
+	maxProfileImageBytes = 5 << 20
+	avatarSize           = 400
+	bannerWidth          = 1500
+	bannerHeight         = 500
+)
+
+var errInvalidProfileImage = errors.New("invalid profile image")
+
+// profileImage is one of the images a user can put on their profile. Every
+// upload is resized to exactly width by height.
+type profileImage struct {
+	name   string
+	width  int
+	height int
+	key    func(user database.User) sql.NullString
+	save   func(ctx context.Context, db *database.Queries, userId uuid.UUID, key sql.NullString) error
+}
+
+var (
+	avatarImage = profileImage{
+		name:   "avatar",
+		width:  avatarSize,
+		height: avatarSize,
+		key:    func(user database.User) sql.NullString { return user.AvatarKey },
+		save: func(ctx context.Context, db *database.Queries, userId uuid.UUID, key sql.NullString) error {
+			return db.SetUserAvatarKey(ctx, database.SetUserAvatarKeyParams{ID: userId, AvatarKey: key})
+		},
+	}
+	bannerImage = profileImage{
+		name:   "banner",
+		width:  bannerWidth,
+		height: bannerHeight,
+		key:    func(user database.User) sql.NullString { return user.BannerKey },
+		save: func(ctx context.Context, db *database.Queries, userId uuid.UUID, key sql.NullString) error {
+			return db.SetUserBannerKey(ctx, database.SetUserBannerKeyParams{ID: userId, BannerKey: key})
+		},
+	}
+)
+
+type profileImagesResponse struct {
+	AvatarURL *string `json:"avatar_url"`
+	BannerURL *string `json:"banner_url"`
+}
+
+// storageURL returns the public URL of an optional stored file.
+func (cfg *apiConfig) storageURL(key sql.NullString) *string {
+	if !key.Valid {
+		return nil
+	}
+	url := cfg.storage.URL(key.String)
+	return &url
+}
+
+// PROFILE IMAGE HANDLERS
+func (cfg *apiConfig) handlerUploadAvatar(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	cfg.uploadProfileImage(w, r, userId, avatarImage)
+}
+
+func (cfg *apiConfig) handlerDeleteAvatar(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	cfg.deleteProfileImage(w, r, userId, avatarImage)
+}
+
+func (cfg *apiConfig) handlerUploadBanner(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	cfg.uploadProfileImage(w, r, userId, bannerImage)
+}
+
+func (cfg *apiConfig) handlerDeleteBanner(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	cfg.deleteProfileImage(w, r, userId, bannerImage)
+}
+
+// uploadProfileImage replaces one of the user's profile images with the
+// multipart "image" file. Each upload gets a new storage key so that
+// clients and caches never keep showing the old image under the same URL.
+func (cfg *apiConfig) uploadProfileImage(w http.ResponseWriter, r *http.Request, userId uuid.UUID, image profileImage) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxProfileImageBytes+1<<20)
+	err := r.ParseMultipartForm(multipartMemoryBytes)
+	if err != nil {
+		respondWithError(w, "There was an error reading the upload", http.StatusBadRequest, err)
+		return
+	}
+
+	file, header, err := r.FormFile("image")
+	if err != nil {
+		respondWithError(w, `An image must be uploaded in the "image" field`, http.StatusBadRequest, err)
+		return
+	}
+	defer file.Close()
+
+	resized, err := readProfileImage(file, header.Size, image)
+	if errors.Is(err, errInvalidProfileImage) {
+		respondWithError(w, "Images must be JPEG, PNG or GIF files of up to 5 MB: "+err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, "There was an error reading the image", http.StatusInternalServerError, err)
+		return
+	}
+
+	key := fmt.Sprintf("%ss/%s_%s.jpg", image.name, userId, uuid.New())
+	err = cfg.storage.Put(r.Context(), key, resized, "image/jpeg")
+	if err != nil {
+		respondWithError(w, "There was an error storing the image", http.StatusInternalServerError, err)
+		return
+	}
+
+	old, err := cfg.swapProfileImage(r.Context(), userId, image, sql.NullString{String: key, Valid: true})
+	if err != nil {
+		cfg.deleteStoredFiles(r.Context(), []string{key})
+		respondWithError(w, "There was an error saving the "+image.name, http.StatusInternalServerError, err)
+		return
+	}
+
+	if old.Valid {
+		cfg.deleteStoredFiles(r.Context(), []string{old.String})
+	}
+
+	cfg.respondWithProfileImages(w, r, userId)
+}
+
+func readProfileImage(file io.Reader, size int64, image profileImage) ([]byte, error) {
+	if size > maxProfileImageBytes {
+		return nil, fmt.Errorf("%w: larger than %d MB", errInvalidProfileImage, maxProfileImageBytes>>20)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(file, maxProfileImageBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxProfileImageBytes {
+		return nil, fmt.Errorf("%w: larger than %d MB", errInvalidProfileImage, maxProfileImageBytes>>20)
+	}
+
+	info, err := imaging.Inspect(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidProfileImage, err)
+	}
+
+	resized, err := imaging.Cover(data, info, image.width, image.height)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidProfileImage, err)
+	}
+	return resized, nil
+}
+
+// swapProfileImage sets one of the user's profile images to key and returns
+// the key it replaced. The user is locked while the two are swapped, so when
+// changes race each old key is only handed back once and every file but the
+// current one gets deleted.
+func (cfg *apiConfig) swapProfileImage(ctx context.Context, userId uuid.UUID, image profileImage, key sql.NullString) (sql.NullString, error) {
+	tx, err := cfg.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	defer tx.Rollback()
+
+	qtx := cfg.db.WithTx(tx)
+
+	user, err := qtx.GetUserByIDForUpdate(ctx, userId)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+
+	old := image.key(user)
+	if !old.Valid && !key.Valid {
+		return old, nil
+	}
+
+	err = image.save(ctx, qtx, userId, key)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+
+	return old, tx.Commit()
+}
+
+func (cfg *apiConfig) deleteProfileImage(w http.ResponseWriter, r *http.Request, userId uuid.UUID, image profileImage) {
+	old, err := cfg.swapProfileImage(r.Context(), userId, image, sql.NullString{})
+	if err != nil {
+		respondWithError(w, "There was an error removing the "+image.name, http.StatusInternalServerError, err)
+		return
+	}
+
+	// The file is only deleted once the user no longer points at it.
+	if old.Valid {
+		cfg.deleteStoredFiles(r.Context(), []string{old.String})
+	}
+
+	cfg.respondWithProfileImages(w, r, userId)
+}
+
+func (cfg *apiConfig) respondWithProfileImages(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	user, err := cfg.db.GetUserByID(r.Context(), userId)
+	if err != nil {
+		respondWithError(w, "There was an error getting the user", http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJson(w, 200, profileImagesResponse{
+		AvatarURL: cfg.storageURL(user.AvatarKey),
+		BannerURL: cfg.storageURL(user.BannerKey),
+	})
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sam-maton/chirpy/internal/database"
+	"github.com/sam-maton/chirpy/internal/entitlements"
+	"github.com/sam-maton/chirpy/internal/ratelimit"
+)
+
+// Rate limit policies for the routes that need one. IP based policies are
+// for routes used before logging in, user based ones for everything else.
+var (
+	loginRateLimit   = ratelimit.Policy{Name: "login", Limit: 10, Period: time.Minute}
+	signupRateLimit  = ratelimit.Policy{Name: "signup", Limit: 5, Period: time.Hour}
+	refreshRateLimit = ratelimit.Policy{Name: "refresh", Limit: 30, Period: time.Minute}
+	webhookRateLimit = ratelimit.Policy{Name: "polka_webhook", Limit: 120, Period: time.Minute}
+	messageRateLimit = ratelimit.Policy{Name: "messages", Limit: 30, Period: time.Minute}
+	reportRateLimit  = ratelimit.Policy{Name: "reports", Limit: 20, Period: time.Hour}
+)
+
+// chirpRateLimit depends on the user's plan, so it is checked in
+// handlerCreateChirp rather than by middleware.
+func chirpRateLimit(ent entitlements.Entitlements) ratelimit.Policy {
+	return ratelimit.Policy{Name: "chirps", Limit: ent.ChirpsPerMinute, Period: time.Minute}
+}
+
+// staleRateLimitBucketAge is how long a bucket has to go unused before it's
+// deleted from Postgres. It only needs to be longer than the longest policy.
+const staleRateLimitBucketAge = 24 * time.Hour
+
+// middlewareRateLimitIP limits requests by the client's IP address.
+func (cfg *apiConfig) middlewareRateLimitIP(policy ratelimit.Policy, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !cfg.takeRateLimit(w, r, policy, "ip:"+cfg.clientIP(r)) {
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// middlewareRateLimitUser limits requests by the authenticated user, so it
+// goes inside middlewareAuth.
+func (cfg *apiConfig) middlewareRateLimitUser(policy ratelimit.Policy, handler func(http.ResponseWriter, *http.Request, uuid.UUID)) func(http.ResponseWriter, *http.Request, uuid.UUID) {
+	return func(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+		if !cfg.takeRateLimit(w, r, policy, "user:"+userId.String()) {
+			return
+		}
+		handler(w, r, userId)
+	}
+}
+
+// takeRateLimit takes a token from the key's bucket and sets the RateLimit
+// headers. It responds with a 429 and returns false when the bucket is empty.
+func (cfg *apiConfig) takeRateLimit(w http.ResponseWriter, r *http.Request, policy ratelimit.Policy, key string) bool {
+	result, err := cfg.rateLimits.Take(r.Context(), policy.Name+":"+key, policy)
+	if err != nil {
+		// A broken store shouldn't take the whole API down with it.
+		log.Printf("There was an error checking the %s rate limit: %s", policy.Name, err)
+		return true
+	}
+
+	w.Header().Set("RateLimit-Policy", policy.Header())
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil(result.Reset.Seconds()))))
+
+	if !result.Allowed {
+		respondWithTooManyRequests(w, "Too many requests, try again later", result.RetryAfter)
+		return false
+	}
+	return true
+}
+
+// pgRateLimitStore keeps the buckets in Postgres so the limits hold across
+// every server.
+type pgRateLimitStore struct {
+	db *database.Queries
+}
+
+func (s pgRateLimitStore) Take(ctx context.Context, key string, policy ratelimit.Policy) (ratelimit.Result, error) {
+	bucket, err := s.db.TakeRateLimitToken(ctx, database.TakeRateLimitTokenParams{
+		Key:        key,
+		Capacity:   float64(policy.Limit),
+		RefillRate: policy.RefillRate(),
+	})
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+	return ratelimit.ResultFor(policy, bucket.Tokens, bucket.Allowed), nil
+}
+
+// runRateLimitCleanup deletes buckets that haven't been used for a long time.
+// It is only started when the buckets are kept in Postgres.
+func (cfg *apiConfig) runRateLimitCleanup(ctx context.Context) {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_, err := cfg.db.DeleteStaleRateLimitBuckets(ctx, time.Now().Add(-staleRateLimitBucketAge))
+			if err != nil {
+				log.Printf("There was an error deleting stale rate limit buckets: %s", err)
+			}
+		}
+	}
+}
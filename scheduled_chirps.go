@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sam-maton/chirpy/internal/database"
+	"github.com/sam-maton/chirpy/internal/webhooks"
+)
+
+const (
+	chirpStatusScheduled = "scheduled"
+	chirpStatusPublished = "published"
+
+	minScheduleDelay       = time.Minute
+	maxScheduleDelay       = 365 * 24 * time.Hour
+	chirpSchedulerInterval = 10 * time.Second
+	chirpSchedulerBatch    = 50
+)
+
+// checkPublishAt makes sure a scheduled chirp goes out at least a minute
+// and at most a year from now.
+func checkPublishAt(publishAt, now time.Time) error {
+	delay := publishAt.Sub(now)
+	if delay < minScheduleDelay || delay > maxScheduleDelay {
+		return fmt.Errorf("publish_at must be between %d minute and %d days from now", int(minScheduleDelay.Minutes()), int(maxScheduleDelay.Hours()/24))
+	}
+	return nil
+}
+
+// afterChirpPublished tells subscribers and webhooks about a chirp once it
+// is public.
+func (cfg *apiConfig) afterChirpPublished(ctx context.Context, chirp database.Chirp, response chirpResponse) {
+	announce, err := cfg.shouldAnnounceChirp(ctx, chirp)
+	if err != nil {
+		log.Printf("There was an error checking whether to announce chirp %s: %s", chirp.ID, err)
+		return
+	}
+	if !announce {
+		return
+	}
+
+	cfg.publishChirpCreated(ctx, chirp, response)
+	cfg.publishWebhookEvent(ctx, chirp.UserID, webhooks.EventChirpCreated, response)
+}
+
+// afterChirpWithdrawn tells subscribers and webhooks that a chirp they were
+// told about is gone, whether it was deleted or is now shadow hidden.
+func (cfg *apiConfig) afterChirpWithdrawn(ctx context.Context, chirp database.Chirp) {
+	cfg.publishChirpDeleted(ctx, chirp)
+	cfg.publishWebhookEvent(ctx, chirp.UserID, webhooks.EventChirpDeleted, struct {
+		ID     uuid.UUID `json:"id"`
+		UserID uuid.UUID `json:"user_id"`
+	}{
+		ID:     chirp.ID,
+		UserID: chirp.UserID,
+	})
+}
+
+// shouldAnnounceChirp reports whether anyone but the author should hear
+// about a chirp going public, and so whether they have to hear when it goes.
+// Scheduled chirps haven't gone out yet. Shadow hidden chirps look posted to
+// their author, but nobody else hears about them, and neither does anyone
+// hear from an author who has been suspended or banned since scheduling one.
+func (cfg *apiConfig) shouldAnnounceChirp(ctx context.Context, chirp database.Chirp) (bool, error) {
+	if chirp.Status != chirpStatusPublished || chirp.ShadowHiddenAt.Valid || chirp.HiddenAt.Valid {
+		return false, nil
+	}
+
+	author, err := cfg.accountStatusFor(ctx, chirp.UserID)
+	if err != nil {
+		return false, err
+	}
+	return !author.disabled(time.Now()), nil
+}
+
+// runChirpScheduler publishes scheduled chirps as they fall due until ctx
+// is cancelled. Schedules live in the database, so chirps that fell due
+// while no server was running go out as soon as one starts, and any number
+// of servers can run it against the same database.
+func (cfg *apiConfig) runChirpScheduler(ctx context.Context) {
+	ticker := time.NewTicker(chirpSchedulerInterval)
+	defer ticker.Stop()
+
+	for {
+		cfg.publishDueChirps(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (cfg *apiConfig) publishDueChirps(ctx context.Context) {
+	for {
+		published, announced, responses, err := cfg.publishDueChirpBatch(ctx)
+		if err != nil {
+			log.Printf("There was an error publishing scheduled chirps: %s", err)
+			return
+		}
+
+		// Webhooks were queued with the batch. Real-time events can only be
+		// sent once it has committed, and like any others are lost if the
+		// server stops first.
+		for i, chirp := range announced {
+			cfg.publishChirpCreated(ctx, chirp, responses[i])
+		}
+
+		if published < chirpSchedulerBatch {
+			return
+		}
+	}
+}
+
+// publishDueChirpBatch publishes a batch of due chirps and queues their
+// webhooks in one transaction, so either both happen or the batch is tried
+// again on the next tick. It returns how many chirps were published, and
+// the ones that should be announced along with their responses.
+func (cfg *apiConfig) publishDueChirpBatch(ctx context.Context) (int, []database.Chirp, []chirpResponse, error) {
+	tx, err := cfg.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	defer tx.Rollback()
+
+	qtx := cfg.db.WithTx(tx)
+
+	chirps, err := qtx.PublishDueChirps(ctx, chirpSchedulerBatch)
+	if err != nil || len(chirps) == 0 {
+		return 0, nil, nil, err
+	}
+
+	// Nobody is viewing, so poll results stay hidden as they would for any
+	// new chirp.
+	responses, err := cfg.chirpsToResponse(ctx, chirps, uuid.NullUUID{})
+	if err != nil {
+		return 0, nil, nil, err
+	}
+
+	announced := []database.Chirp{}
+	announcedResponses := []chirpResponse{}
+	for i, chirp := range chirps {
+		announce, err := cfg.shouldAnnounceChirp(ctx, chirp)
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		if !announce {
+			continue
+		}
+
+		err = cfg.enqueueWebhookEvent(ctx, qtx, chirp.UserID, webhooks.EventChirpCreated, responses[i])
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		announced = append(announced, chirp)
+		announcedResponses = append(announcedResponses, responses[i])
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	return len(chirps), announced, announcedResponses, nil
+}
+
+// SCHEDULED CHIRP HANDLERS
+func (cfg *apiConfig) handlerGetScheduledChirps(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	chirps, err := cfg.db.GetScheduledChirpsByUserID(r.Context(), userId)
+	if err != nil {
+		respondWithError(w, "There was an error getting the scheduled chirps", http.StatusInternalServerError, err)
+		return
+	}
+
+	response, err := cfg.chirpsToResponse(r.Context(), chirps, uuid.NullUUID{UUID: userId, Valid: true})
+	if err != nil {
+		respondWithError(w, "There was an error getting the chirps' details", http.StatusInternalServerError, err)
+		return
+	}
+	respondWithJson(w, 200, response)
+}
+
+func (cfg *apiConfig) handlerRescheduleChirp(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	type params struct {
+		PublishAt *time.Time `json:"publish_at"`
+	}
+
+	chirpId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, "Not a valid ID", http.StatusBadRequest, err)
+		return
+	}
+
+	p := params{}
+	err = json.NewDecoder(r.Body).Decode(&p)
+	if err != nil {
+		respondWithError(w, paramsDecodeError, http.StatusBadRequest, err)
+		return
+	}
+	if p.PublishAt == nil {
+		respondWithError(w, "publish_at is required", http.StatusBadRequest, nil)
+		return
+	}
+
+	err = checkPublishAt(*p.PublishAt, time.Now())
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	chirp, err := cfg.rescheduleChirp(r.Context(), database.RescheduleChirpParams{
+		ID:        chirpId,
+		UserID:    userId,
+		PublishAt: sql.NullTime{Time: *p.PublishAt, Valid: true},
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, "Scheduled chirp could not be found", http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, "There was an error rescheduling the chirp", http.StatusInternalServerError, err)
+		return
+	}
+
+	cfg.respondWithChirp(w, r, 200, chirp, uuid.NullUUID{UUID: userId, Valid: true})
+}
+
+// rescheduleChirp moves a scheduled chirp and keeps its poll, if it has one,
+// open for as long as it was going to be after the chirp is published.
+func (cfg *apiConfig) rescheduleChirp(ctx context.Context, params database.RescheduleChirpParams) (database.Chirp, error) {
+	tx, err := cfg.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	defer tx.Rollback()
+
+	qtx := cfg.db.WithTx(tx)
+
+	old, err := qtx.GetChirpForUpdate(ctx, params.ID)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+
+	chirp, err := qtx.RescheduleChirp(ctx, params)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+
+	poll, err := qtx.GetPoll(ctx, chirp.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return database.Chirp{}, err
+	}
+	if err == nil {
+		err = qtx.SetPollClosesAt(ctx, database.SetPollClosesAtParams{
+			ChirpID:  chirp.ID,
+			ClosesAt: poll.ClosesAt.Add(chirp.PublishAt.Time.Sub(old.PublishAt.Time)),
+		})
+		if err != nil {
+			return database.Chirp{}, err
+		}
+	}
+
+	return chirp, tx.Commit()
+}
+
+// handlerCancelScheduledChirp deletes a chirp that hasn't been published
+// yet. Chirps that have already gone out are deleted the usual way.
+func (cfg *apiConfig) handlerCancelScheduledChirp(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	chirpId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, "Not a valid ID", http.StatusBadRequest, err)
+		return
+	}
+
+	attachments, err := cfg.db.GetAttachmentsByChirpIDs(r.Context(), []uuid.UUID{chirpId})
+	if err != nil {
+		respondWithError(w, "There was an error getting the chirp's attachments", http.StatusInternalServerError, err)
+		return
+	}
+
+	deleted, err := cfg.db.DeleteScheduledChirp(r.Context(), database.DeleteScheduledChirpParams{
+		ID:     chirpId,
+		UserID: userId,
+	})
+	if err != nil {
+		respondWithError(w, "There was an error cancelling the chirp", http.StatusInternalServerError, err)
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, "Scheduled chirp could not be found", http.StatusNotFound, nil)
+		return
+	}
+
+	cfg.deleteStoredFiles(r.Context(), attachmentKeys(attachments))
+
+	respondWithJson(w, 204, struct{}{})
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sam-maton/chirpy/internal/database"
+	"github.com/sam-maton/chirpy/internal/spam"
+)
+
+// checkChirpForSpam runs the spam pipeline over a chirp the user is about
+// to post, or over the new text of a chirp they are editing. editing is the
+// ID of that chirp, or uuid.Nil for a new one.
+func (cfg *apiConfig) checkChirpForSpam(ctx context.Context, userId uuid.UUID, body string, editing uuid.UUID) (spam.Decision, error) {
+	now := time.Now()
+
+	author, err := cfg.db.GetUserByID(ctx, userId)
+	if err != nil {
+		return spam.Decision{}, err
+	}
+
+	recent, err := cfg.db.GetChirpBodiesByUserSince(ctx, database.GetChirpBodiesByUserSinceParams{
+		UserID:    userId,
+		Since:     now.Add(-cfg.spam.Window),
+		ExcludeID: editing,
+	})
+	if err != nil {
+		return spam.Decision{}, err
+	}
+
+	return cfg.spam.Evaluate(ctx, spam.Input{
+		Body:            body,
+		AuthorCreatedAt: author.CreatedAt,
+		RecentBodies:    recent,
+		Now:             now,
+		Editing:         editing != uuid.Nil,
+	})
+}
+
+// reportSpam puts a chirp the spam checks didn't like in the moderation
+// queue. The report has no reporter, which is how moderators can tell it
+// apart from one made by a user.
+func (cfg *apiConfig) reportSpam(ctx context.Context, chirp database.Chirp, decision spam.Decision) {
+	details := fmt.Sprintf("Automatic spam check (%s, score %.2f)", decision.Verdict, decision.Score)
+	if len(decision.Reasons) > 0 {
+		details += ": " + strings.Join(decision.Reasons, ", ")
+	}
+
+	_, err := cfg.db.CreateReport(ctx, database.CreateReportParams{
+		ChirpID:    chirp.ID,
+		ReporterID: uuid.NullUUID{},
+		Reason:     "spam",
+		Details:    sql.NullString{String: details, Valid: true},
+	})
+	if err != nil {
+		log.Printf("There was an error reporting chirp %s as spam: %s", chirp.ID, err)
+	}
+}
@@ -0,0 +1,9 @@
+-- name: CreateChirpAttachment :one
+INSERT INTO chirp_attachments (id, created_at, chirp_id, position, content_type, size_bytes, width, height, storage_key, thumbnail_key)
+VALUES ($1, NOW(), $2, $3, $4, $5, $6, $7, $8, $9)
+RETURNING *;
+
+-- name: GetAttachmentsByChirpIDs :many
+SELECT * FROM chirp_attachments
+WHERE chirp_id = ANY(@chirp_ids::uuid[])
+ORDER BY chirp_id, position;
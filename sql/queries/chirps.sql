@@ -1,21 +1,88 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
-VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, shadow_hidden_at, publish_at, status)
+VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2, $3, $4, $5)
 RETURNING *;
 
 -- name: GetChirps :many
 SELECT * FROM chirps
+WHERE hidden_at IS NULL AND status = 'published'
+  AND user_id NOT IN (SELECT id FROM users WHERE banned_at IS NOT NULL)
 ORDER BY created_at ASC;
 
 -- name: GetChirpByID :one
 SELECT * FROM chirps
 WHERE id = $1;
 
+-- name: GetChirpForUpdate :one
+SELECT * FROM chirps
+WHERE id = $1
+FOR UPDATE;
+
 -- name: GetChirpsByUserID :many
 SELECT * FROM chirps
-WHERE user_id = $1
+WHERE user_id = $1 AND hidden_at IS NULL AND status = 'published'
+  AND user_id NOT IN (SELECT id FROM users WHERE banned_at IS NOT NULL)
 ORDER BY created_at ASC;
 
 -- name: DeleteChirp :exec
 DELETE FROM chirps
-WHERE id = $1;
\ No newline at end of file
+WHERE id = $1;
+
+-- name: UpdateChirpBody :one
+UPDATE chirps
+SET body = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: HideChirp :exec
+UPDATE chirps
+SET hidden_at = NOW(), updated_at = NOW()
+WHERE id = $1;
+
+-- name: ClearChirpShadowHidden :exec
+UPDATE chirps
+SET shadow_hidden_at = NULL
+WHERE id = $1;
+
+-- name: ShadowHideChirp :exec
+UPDATE chirps
+SET shadow_hidden_at = NOW()
+WHERE id = $1 AND shadow_hidden_at IS NULL;
+
+-- name: GetChirpBodiesByUserSince :many
+-- A chirp being edited is left out so its old text doesn't count against
+-- the new.
+SELECT body FROM chirps
+WHERE user_id = @user_id AND created_at > @since AND id <> @exclude_id
+ORDER BY created_at DESC;
+
+-- name: GetScheduledChirpsByUserID :many
+SELECT * FROM chirps
+WHERE user_id = $1 AND status = 'scheduled'
+ORDER BY publish_at ASC;
+
+-- name: RescheduleChirp :one
+UPDATE chirps
+SET publish_at = $3, updated_at = NOW()
+WHERE id = $1 AND user_id = $2 AND status = 'scheduled'
+RETURNING *;
+
+-- name: DeleteScheduledChirp :execrows
+DELETE FROM chirps
+WHERE id = $1 AND user_id = $2 AND status = 'scheduled';
+
+-- name: PublishDueChirps :many
+-- Rows being published by another server are skipped rather than waited
+-- for, so any number of schedulers can run at once without publishing a
+-- chirp twice. A published chirp's created_at becomes the time it went out,
+-- so it sorts as new in timelines.
+UPDATE chirps
+SET status = 'published', created_at = NOW(), updated_at = NOW()
+WHERE id IN (
+  SELECT id FROM chirps
+  WHERE status = 'scheduled' AND publish_at <= NOW()
+  ORDER BY publish_at ASC
+  LIMIT $1
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
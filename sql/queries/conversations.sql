@@ -0,0 +1,29 @@
+-- name: GetOrCreateConversation :one
+INSERT INTO conversations (id, created_at, updated_at, user_a_id, user_b_id)
+VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2)
+ON CONFLICT (user_a_id, user_b_id) DO UPDATE SET updated_at = conversations.updated_at
+RETURNING *;
+
+-- name: GetConversationByID :one
+SELECT * FROM conversations
+WHERE id = $1;
+
+-- name: GetConversationsByUserID :many
+SELECT
+  c.id,
+  c.created_at,
+  c.last_message_at,
+  (CASE WHEN c.user_a_id = @user_id THEN c.user_b_id ELSE c.user_a_id END)::uuid AS other_user_id,
+  (
+    SELECT COUNT(*) FROM messages m
+    WHERE m.conversation_id = c.id AND m.sender_id <> @user_id AND m.read_at IS NULL
+  ) AS unread_count
+FROM conversations c
+WHERE c.user_a_id = @user_id OR c.user_b_id = @user_id
+ORDER BY COALESCE(c.last_message_at, c.created_at) DESC
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
+
+-- name: TouchConversation :exec
+UPDATE conversations
+SET last_message_at = NOW(), updated_at = NOW()
+WHERE id = $1;
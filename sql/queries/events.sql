@@ -0,0 +1,16 @@
+-- name: CreateEventPayload :one
+-- Event IDs come from event_id_seq so they are the same on every server.
+INSERT INTO event_payloads (id, created_at, data)
+VALUES (nextval('event_id_seq'), NOW(), $1)
+RETURNING id;
+
+-- name: GetEventPayload :one
+SELECT data FROM event_payloads
+WHERE id = $1;
+
+-- name: DeleteEventPayloadsBefore :exec
+DELETE FROM event_payloads
+WHERE created_at < $1;
+
+-- name: NotifyEvent :exec
+SELECT pg_notify(@channel::text, @payload::text);
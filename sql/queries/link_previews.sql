@@ -0,0 +1,50 @@
+-- name: QueueLinkPreview :exec
+-- Links seen for the first time are queued for fetching. Known links are
+-- only fetched again once their preview is older than the stale cutoff.
+INSERT INTO link_previews (url, created_at, updated_at, status, next_attempt_at)
+VALUES (@url, NOW(), NOW(), 'pending', NOW())
+ON CONFLICT (url) DO UPDATE
+SET status = 'pending', attempts = 0, next_attempt_at = NOW(), updated_at = NOW()
+WHERE link_previews.status <> 'pending' AND link_previews.fetched_at < @stale_before::timestamp;
+
+-- name: CreateChirpLink :exec
+INSERT INTO chirp_links (chirp_id, position, url)
+VALUES ($1, $2, $3);
+
+-- name: DeleteChirpLinks :exec
+DELETE FROM chirp_links
+WHERE chirp_id = $1;
+
+-- name: ClaimLinkPreviews :many
+-- Claimed previews are pushed back by a lease, as webhook deliveries are, so
+-- only one server fetches each link.
+UPDATE link_previews
+SET attempts = attempts + 1, next_attempt_at = NOW() + INTERVAL '2 minutes', updated_at = NOW()
+WHERE url IN (
+  SELECT url FROM link_previews
+  WHERE status = 'pending' AND next_attempt_at <= NOW()
+  ORDER BY next_attempt_at ASC
+  LIMIT $1
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING url, attempts;
+
+-- name: SaveLinkPreview :exec
+UPDATE link_previews
+SET status = 'ready', fetched_at = NOW(), updated_at = NOW(), last_error = NULL,
+  title = $2, description = $3, image_url = $4, site_name = $5
+WHERE url = $1;
+
+-- name: MarkLinkPreviewFailed :exec
+-- The last good preview, if there is one, is kept.
+UPDATE link_previews
+SET status = $2, next_attempt_at = $3, last_error = $4, fetched_at = NOW(), updated_at = NOW()
+WHERE url = $1;
+
+-- name: GetLinkPreviewsByChirpIDs :many
+SELECT chirp_links.chirp_id, link_previews.url, link_previews.title, link_previews.description, link_previews.image_url, link_previews.site_name
+FROM chirp_links
+JOIN link_previews ON link_previews.url = chirp_links.url
+WHERE chirp_links.chirp_id = ANY(@chirp_ids::uuid[])
+  AND (link_previews.title IS NOT NULL OR link_previews.description IS NOT NULL OR link_previews.image_url IS NOT NULL)
+ORDER BY chirp_links.chirp_id, chirp_links.position;
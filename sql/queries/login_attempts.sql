@@ -0,0 +1,22 @@
+-- name: CreateLoginAttempt :exec
+INSERT INTO login_attempts (id, created_at, email, ip_address, user_agent, user_id, succeeded)
+VALUES (gen_random_uuid(), NOW(), $1, $2, $3, $4, $5);
+
+-- name: GetFailedLoginStatsByEmail :one
+-- Failures only count since the last successful login for the account.
+SELECT COUNT(*) AS failures, COALESCE(MAX(created_at), 'epoch')::timestamp AS last_failed_at
+FROM login_attempts
+WHERE email = @email
+  AND succeeded = FALSE
+  AND created_at > @since
+  AND created_at > (
+    SELECT COALESCE(MAX(created_at), 'epoch') FROM login_attempts
+    WHERE email = @email AND succeeded = TRUE
+  );
+
+-- name: GetFailedLoginStatsByIP :one
+SELECT COUNT(*) AS failures, COALESCE(MAX(created_at), 'epoch')::timestamp AS last_failed_at
+FROM login_attempts
+WHERE ip_address = @ip_address
+  AND succeeded = FALSE
+  AND created_at > @since;
@@ -0,0 +1,16 @@
+-- name: CreateMessage :one
+INSERT INTO messages (id, created_at, conversation_id, sender_id, body)
+VALUES (gen_random_uuid(), NOW(), $1, $2, $3)
+RETURNING *;
+
+-- name: GetMessagesByConversationID :many
+SELECT * FROM messages
+WHERE conversation_id = $1
+ORDER BY created_at DESC
+LIMIT $2 OFFSET $3;
+
+-- name: MarkConversationRead :execrows
+-- Marks the messages the other user sent as read.
+UPDATE messages
+SET read_at = NOW()
+WHERE conversation_id = @conversation_id AND sender_id <> @user_id AND read_at IS NULL;
@@ -0,0 +1,12 @@
+-- name: CreateOIDCLoginState :exec
+INSERT INTO oidc_login_states (state, created_at, expires_at, code_verifier, nonce)
+VALUES ($1, NOW(), $2, $3, $4);
+
+-- name: ConsumeOIDCLoginState :one
+DELETE FROM oidc_login_states
+WHERE state = $1
+RETURNING *;
+
+-- name: DeleteExpiredOIDCLoginStates :exec
+DELETE FROM oidc_login_states
+WHERE expires_at < NOW();
@@ -0,0 +1,20 @@
+-- name: TakeRateLimitToken :one
+-- The bucket is refilled for the time since it was last used and a token is
+-- taken if there is one, in a single statement so concurrent requests can't
+-- both take the last token. SET expressions see the row as it was before the
+-- update.
+INSERT INTO rate_limit_buckets (key, tokens, allowed, updated_at)
+VALUES (@key, @capacity::float8 - 1, TRUE, NOW())
+ON CONFLICT (key) DO UPDATE
+SET allowed = LEAST(@capacity::float8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM NOW() - rate_limit_buckets.updated_at)::float8 * @refill_rate::float8) >= 1,
+  tokens = CASE
+    WHEN LEAST(@capacity::float8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM NOW() - rate_limit_buckets.updated_at)::float8 * @refill_rate::float8) >= 1
+    THEN LEAST(@capacity::float8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM NOW() - rate_limit_buckets.updated_at)::float8 * @refill_rate::float8) - 1
+    ELSE LEAST(@capacity::float8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM NOW() - rate_limit_buckets.updated_at)::float8 * @refill_rate::float8)
+  END,
+  updated_at = NOW()
+RETURNING tokens, allowed;
+
+-- name: DeleteStaleRateLimitBuckets :execrows
+DELETE FROM rate_limit_buckets
+WHERE updated_at < $1;
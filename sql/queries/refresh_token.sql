@@ -12,6 +12,11 @@ UPDATE refresh_tokens
 SET revoked_at = NOW(), updated_at = NOW()
 WHERE token = $1;
 
+-- name: RevokeUserRefreshTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
+
 -- name: GetUserByRefreshToken :one
 SELECT * FROM users
 WHERE id = (SELECT user_id FROM refresh_tokens WHERE token = $1);
\ No newline at end of file
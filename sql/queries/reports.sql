@@ -0,0 +1,36 @@
+-- name: CreateReport :one
+INSERT INTO reports (id, created_at, updated_at, chirp_id, reporter_id, reason, details)
+VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2, $3, $4)
+ON CONFLICT (chirp_id, reporter_id) DO NOTHING
+RETURNING *;
+
+-- name: GetReportByID :one
+SELECT * FROM reports
+WHERE id = $1;
+
+-- name: GetReportsByStatus :many
+SELECT
+  reports.id,
+  reports.created_at,
+  reports.chirp_id,
+  reports.reporter_id,
+  reports.reason,
+  reports.details,
+  reports.status,
+  reports.resolved_at,
+  reports.resolved_by,
+  chirps.body AS chirp_body,
+  chirps.user_id AS chirp_user_id,
+  chirps.hidden_at AS chirp_hidden_at,
+  chirps.shadow_hidden_at AS chirp_shadow_hidden_at
+FROM reports
+JOIN chirps ON chirps.id = reports.chirp_id
+WHERE reports.status = $1
+ORDER BY reports.created_at ASC
+LIMIT $2 OFFSET $3;
+
+-- name: ResolveReportsForChirp :execrows
+-- Deciding on one report settles every open report about the same chirp.
+UPDATE reports
+SET updated_at = NOW(), status = $2, resolved_at = NOW(), resolved_by = $3
+WHERE chirp_id = $1 AND status = 'open';
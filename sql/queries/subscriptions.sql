@@ -0,0 +1,32 @@
+-- name: UpsertSubscription :one
+INSERT INTO subscriptions (id, created_at, updated_at, user_id, plan, status, current_period_end)
+VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2, 'active', $3)
+ON CONFLICT (user_id) DO UPDATE
+SET updated_at = NOW(), plan = EXCLUDED.plan, status = 'active', current_period_end = EXCLUDED.current_period_end
+RETURNING *;
+
+-- name: SetSubscriptionStatus :one
+UPDATE subscriptions
+SET updated_at = NOW(), status = $2
+WHERE user_id = $1
+RETURNING *;
+
+-- name: EndSubscription :one
+UPDATE subscriptions
+SET updated_at = NOW(), status = $2, current_period_end = LEAST(current_period_end, NOW())
+WHERE user_id = $1
+RETURNING *;
+
+-- name: GetSubscriptionByUserID :one
+SELECT * FROM subscriptions
+WHERE user_id = $1;
+
+-- name: IsUserChirpyRed :one
+-- Canceled subscriptions and ones with a failed payment keep Chirpy Red until
+-- the end of the period that was paid for.
+SELECT EXISTS (
+  SELECT 1 FROM subscriptions
+  WHERE user_id = $1
+    AND status IN ('active', 'past_due', 'canceled')
+    AND current_period_end > NOW()
+);
@@ -0,0 +1,8 @@
+-- name: UseMFAToken :execrows
+INSERT INTO used_mfa_tokens (id, expires_at)
+VALUES ($1, $2)
+ON CONFLICT (id) DO NOTHING;
+
+-- name: DeleteExpiredMFATokens :exec
+DELETE FROM used_mfa_tokens
+WHERE expires_at < NOW();
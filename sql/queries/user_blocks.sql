@@ -0,0 +1,29 @@
+-- name: IsBlockedBetween :one
+SELECT EXISTS (
+  SELECT 1 FROM user_blocks
+  WHERE (blocker_id = @user_id AND blocked_id = @other_user_id)
+    OR (blocker_id = @other_user_id AND blocked_id = @user_id)
+);
+
+-- name: BlockUser :exec
+INSERT INTO user_blocks (blocker_id, blocked_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (blocker_id, blocked_id) DO NOTHING;
+
+-- name: UnblockUser :execrows
+DELETE FROM user_blocks
+WHERE blocker_id = $1 AND blocked_id = $2;
+
+-- name: GetBlockedUsers :many
+SELECT blocked_id, created_at FROM user_blocks
+WHERE blocker_id = $1
+ORDER BY created_at DESC;
+
+-- name: GetHiddenAuthorIDs :many
+-- Authors whose chirps the user shouldn't see: anyone they blocked or muted,
+-- and anyone who blocked them.
+SELECT blocked_id AS user_id FROM user_blocks WHERE blocker_id = @user_id
+UNION
+SELECT blocker_id FROM user_blocks WHERE blocked_id = @user_id
+UNION
+SELECT muted_id FROM user_mutes WHERE muter_id = @user_id;
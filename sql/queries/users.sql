@@ -1,20 +1,89 @@
 -- name: CreateUser :one
 INSERT INTO users (id, created_at, updated_at, email, hashed_password)
 VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2)
-RETURNING id, created_at, updated_at, email, is_chirpy_red;
+RETURNING id, created_at, updated_at, email, role;
 
 -- name: GetUserByEmail :one
 SELECT * FROM users
 WHERE email = $1;
 
+-- name: GetUserByID :one
+SELECT * FROM users
+WHERE id = $1;
+
+-- name: GetUserByIDForUpdate :one
+-- Locks the user until the transaction ends, so changes that depend on what
+-- was read can't interleave.
+SELECT * FROM users
+WHERE id = $1
+FOR UPDATE;
+
 -- name: UpdateUser :one
 UPDATE users
 SET updated_at = NOW(), email = $2, hashed_password = $3
 WHERE id = $1
-RETURNING id, email, created_at, updated_at, is_chirpy_red;
+RETURNING id, email, created_at, updated_at, role, avatar_key, banner_key;
 
--- name: UpgradeUser :one
+-- name: SetUserRole :one
 UPDATE users
-SET updated_at = NOW(), is_chirpy_red = true
+SET updated_at = NOW(), role = $2
 WHERE id = $1
-RETURNING id, email, updated_at, is_chirpy_red;
\ No newline at end of file
+RETURNING id, email, updated_at, role;
+
+-- name: SetUserTOTPSecret :exec
+UPDATE users
+SET updated_at = NOW(), totp_secret = $2, totp_enabled = FALSE, totp_last_step = NULL
+WHERE id = $1;
+
+-- name: EnableUserTOTP :exec
+UPDATE users
+SET updated_at = NOW(), totp_enabled = TRUE, totp_last_step = $2
+WHERE id = $1;
+
+-- name: DisableUserTOTP :exec
+UPDATE users
+SET updated_at = NOW(), totp_secret = NULL, totp_enabled = FALSE, totp_last_step = NULL
+WHERE id = $1;
+
+-- name: UseTOTPStep :execrows
+-- The step is checked and recorded in one statement so two requests can't
+-- both use the same code.
+UPDATE users
+SET totp_last_step = $2
+WHERE id = $1 AND (totp_last_step IS NULL OR totp_last_step < $2);
+
+-- name: UpdateUserPasswordHash :execrows
+-- Only the hash that was verified is replaced, so a password changed in the
+-- meantime isn't put back.
+UPDATE users
+SET hashed_password = @new_hash
+WHERE id = @id AND hashed_password = @old_hash;
+
+-- name: SuspendUser :exec
+UPDATE users
+SET updated_at = NOW(), suspended_until = $2, suspension_reason = $3
+WHERE id = $1;
+
+-- name: BanUser :exec
+UPDATE users
+SET updated_at = NOW(), banned_at = NOW(), suspension_reason = $2
+WHERE id = $1;
+
+-- name: UnsuspendUser :exec
+UPDATE users
+SET updated_at = NOW(), suspended_until = NULL, banned_at = NULL, suspension_reason = NULL
+WHERE id = $1;
+
+-- name: SetUserAvatarKey :exec
+UPDATE users
+SET updated_at = NOW(), avatar_key = $2
+WHERE id = $1;
+
+-- name: SetUserBannerKey :exec
+UPDATE users
+SET updated_at = NOW(), banner_key = $2
+WHERE id = $1;
+
+-- name: GetUserAvatarKeys :many
+SELECT id, avatar_key FROM users
+WHERE id = ANY(@user_ids::uuid[]);
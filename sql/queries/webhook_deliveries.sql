@@ -0,0 +1,43 @@
+-- name: CreateWebhookDelivery :exec
+INSERT INTO webhook_deliveries (id, created_at, updated_at, subscription_id, event_type, payload, status, next_attempt_at)
+VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2, $3, 'pending', NOW());
+
+-- name: ClaimWebhookDeliveries :many
+-- Claimed deliveries are pushed back by a lease so no other dispatcher picks
+-- them up while they are being sent. If the server dies mid-send they are
+-- tried again once the lease runs out.
+-- owner_allowed is false once the subscription's owner could no longer
+-- subscribe to it, so deliveries queued before that can be dropped.
+UPDATE webhook_deliveries
+SET attempts = attempts + 1, next_attempt_at = NOW() + INTERVAL '2 minutes', updated_at = NOW()
+FROM webhook_subscriptions
+JOIN users ON users.id = webhook_subscriptions.user_id
+WHERE webhook_subscriptions.id = webhook_deliveries.subscription_id
+  AND webhook_deliveries.id IN (
+    SELECT id FROM webhook_deliveries
+    WHERE status = 'pending' AND next_attempt_at <= NOW()
+    ORDER BY next_attempt_at ASC
+    LIMIT $1
+    FOR UPDATE SKIP LOCKED
+  )
+RETURNING webhook_deliveries.id, webhook_deliveries.event_type, webhook_deliveries.payload, webhook_deliveries.attempts, webhook_subscriptions.url, webhook_subscriptions.secret, (
+  (NOT webhook_subscriptions.is_global OR users.role = 'admin')
+  AND users.banned_at IS NULL
+  AND (users.suspended_until IS NULL OR users.suspended_until <= NOW())
+)::boolean AS owner_allowed;
+
+-- name: MarkWebhookDeliveryDelivered :exec
+UPDATE webhook_deliveries
+SET status = 'delivered', delivered_at = NOW(), updated_at = NOW(), response_status = $2, last_error = NULL
+WHERE id = $1;
+
+-- name: MarkWebhookDeliveryFailed :exec
+UPDATE webhook_deliveries
+SET status = $2, next_attempt_at = $3, response_status = $4, last_error = $5, updated_at = NOW()
+WHERE id = $1;
+
+-- name: GetWebhookDeliveriesBySubscriptionID :many
+SELECT * FROM webhook_deliveries
+WHERE subscription_id = $1
+ORDER BY created_at DESC
+LIMIT $2 OFFSET $3;
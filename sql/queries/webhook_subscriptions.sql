@@ -0,0 +1,29 @@
+-- name: CreateWebhookSubscription :one
+INSERT INTO webhook_subscriptions (id, created_at, updated_at, user_id, url, secret, events, is_global)
+VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2, $3, $4, $5)
+RETURNING *;
+
+-- name: GetWebhookSubscriptionsByUserID :many
+SELECT * FROM webhook_subscriptions
+WHERE user_id = $1
+ORDER BY created_at ASC;
+
+-- name: GetWebhookSubscriptionByID :one
+SELECT * FROM webhook_subscriptions
+WHERE id = $1;
+
+-- name: DeleteWebhookSubscription :execrows
+DELETE FROM webhook_subscriptions
+WHERE id = $1 AND user_id = $2;
+
+-- name: GetWebhookSubscriptionsForEvent :many
+-- Global subscriptions get every user's events, the rest only get events
+-- about the user who owns them. The owner is checked every time, so a global
+-- subscription stops when its owner is no longer an admin and nobody's
+-- subscriptions get events while they are banned or suspended.
+SELECT webhook_subscriptions.id FROM webhook_subscriptions
+JOIN users ON users.id = webhook_subscriptions.user_id
+WHERE ((webhook_subscriptions.is_global AND users.role = 'admin') OR webhook_subscriptions.user_id = @user_id)
+  AND @event_type::text = ANY(string_to_array(webhook_subscriptions.events, ' '))
+  AND users.banned_at IS NULL
+  AND (users.suspended_until IS NULL OR users.suspended_until <= NOW());
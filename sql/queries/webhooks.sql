@@ -0,0 +1,24 @@
+-- name: MarkWebhookEventProcessed :execrows
+INSERT INTO processed_webhook_events (event_id, event_type, processed_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (event_id) DO NOTHING;
+
+-- name: CreateWebhookEvent :one
+INSERT INTO webhook_events (id, received_at, updated_at, source, headers, body, outcome, replay_of)
+VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2, $3, 'received', $4)
+RETURNING *;
+
+-- name: UpdateWebhookEventOutcome :exec
+UPDATE webhook_events
+SET updated_at = NOW(), signature_valid = $2, event_id = $3, event_type = $4, outcome = $5, error = $6
+WHERE id = $1;
+
+-- name: GetWebhookEvent :one
+SELECT * FROM webhook_events
+WHERE id = $1;
+
+-- name: GetWebhookEvents :many
+SELECT id, received_at, source, signature_valid, event_id, event_type, outcome, error, replay_of FROM webhook_events
+WHERE (sqlc.narg('outcome')::text IS NULL OR outcome = sqlc.narg('outcome'))
+ORDER BY received_at DESC
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
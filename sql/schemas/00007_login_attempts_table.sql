@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE login_attempts(
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL,
+  email TEXT NOT NULL,
+  ip_address TEXT NOT NULL,
+  user_agent TEXT NOT NULL,
+  user_id UUID,
+  succeeded BOOLEAN NOT NULL,
+  CONSTRAINT fk_user_id
+    FOREIGN KEY (user_id)
+      REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX login_attempts_email_idx ON login_attempts (email, created_at);
+CREATE INDEX login_attempts_ip_address_idx ON login_attempts (ip_address, created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE login_attempts;
+-- +goose StatementEnd
@@ -0,0 +1,41 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE subscriptions(
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP NOT NULL,
+  user_id UUID UNIQUE NOT NULL,
+  plan TEXT NOT NULL,
+  status TEXT NOT NULL
+    CHECK (status IN ('active', 'past_due', 'canceled', 'refunded')),
+  current_period_end TIMESTAMP NOT NULL,
+  CONSTRAINT fk_user_id
+    FOREIGN KEY (user_id)
+      REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Existing Chirpy Red users get a subscription that runs until their next
+-- renewal webhook arrives.
+INSERT INTO subscriptions (id, created_at, updated_at, user_id, plan, status, current_period_end)
+SELECT gen_random_uuid(), NOW(), NOW(), id, 'chirpy_red', 'active', NOW() + INTERVAL '30 days'
+FROM users
+WHERE is_chirpy_red;
+
+ALTER TABLE users
+  DROP COLUMN is_chirpy_red;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users
+  ADD COLUMN is_chirpy_red BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE users
+SET is_chirpy_red = TRUE
+WHERE id IN (
+  SELECT user_id FROM subscriptions
+  WHERE status IN ('active', 'past_due', 'canceled') AND current_period_end > NOW()
+);
+
+DROP TABLE subscriptions;
+-- +goose StatementEnd
@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE webhook_events(
+  id UUID PRIMARY KEY,
+  received_at TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP NOT NULL,
+  source TEXT NOT NULL,
+  headers JSONB NOT NULL,
+  body BYTEA NOT NULL,
+  signature_valid BOOLEAN NOT NULL DEFAULT FALSE,
+  event_id TEXT,
+  event_type TEXT,
+  outcome TEXT NOT NULL
+    CHECK (outcome IN ('received', 'processed', 'duplicate', 'ignored', 'rejected', 'failed')),
+  error TEXT,
+  replay_of UUID,
+  CONSTRAINT fk_replay_of
+    FOREIGN KEY (replay_of)
+      REFERENCES webhook_events(id) ON DELETE SET NULL
+);
+
+CREATE INDEX webhook_events_received_at_idx ON webhook_events (received_at DESC);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE webhook_events;
+-- +goose StatementEnd
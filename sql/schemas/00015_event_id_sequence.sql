@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Real-time event IDs come from the database so they are the same on every
+-- server and a client can resume a stream against any of them.
+CREATE SEQUENCE event_id_seq;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP SEQUENCE event_id_seq;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE user_blocks(
+  blocker_id UUID NOT NULL,
+  blocked_id UUID NOT NULL,
+  created_at TIMESTAMP NOT NULL,
+  PRIMARY KEY (blocker_id, blocked_id),
+  CONSTRAINT fk_blocker_id
+    FOREIGN KEY (blocker_id)
+      REFERENCES users(id) ON DELETE CASCADE,
+  CONSTRAINT fk_blocked_id
+    FOREIGN KEY (blocked_id)
+      REFERENCES users(id) ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE user_blocks;
+-- +goose StatementEnd
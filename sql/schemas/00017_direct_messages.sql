@@ -0,0 +1,46 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Conversations are between two users. The pair is stored with the lower ID
+-- first so there is only ever one conversation between the same two people.
+CREATE TABLE conversations(
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP NOT NULL,
+  user_a_id UUID NOT NULL,
+  user_b_id UUID NOT NULL,
+  last_message_at TIMESTAMP,
+  UNIQUE (user_a_id, user_b_id),
+  CHECK (user_a_id < user_b_id),
+  CONSTRAINT fk_user_a_id
+    FOREIGN KEY (user_a_id)
+      REFERENCES users(id) ON DELETE CASCADE,
+  CONSTRAINT fk_user_b_id
+    FOREIGN KEY (user_b_id)
+      REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX conversations_user_b_id_idx ON conversations (user_b_id);
+
+CREATE TABLE messages(
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL,
+  conversation_id UUID NOT NULL,
+  sender_id UUID NOT NULL,
+  body TEXT NOT NULL,
+  read_at TIMESTAMP,
+  CONSTRAINT fk_conversation_id
+    FOREIGN KEY (conversation_id)
+      REFERENCES conversations(id) ON DELETE CASCADE,
+  CONSTRAINT fk_sender_id
+    FOREIGN KEY (sender_id)
+      REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX messages_conversation_id_created_at_idx ON messages (conversation_id, created_at DESC);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE messages;
+DROP TABLE conversations;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE user_mutes(
+  muter_id UUID NOT NULL,
+  muted_id UUID NOT NULL,
+  created_at TIMESTAMP NOT NULL,
+  PRIMARY KEY (muter_id, muted_id),
+  CONSTRAINT fk_muter_id
+    FOREIGN KEY (muter_id)
+      REFERENCES users(id) ON DELETE CASCADE,
+  CONSTRAINT fk_muted_id
+    FOREIGN KEY (muted_id)
+      REFERENCES users(id) ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE user_mutes;
+-- +goose StatementEnd
@@ -0,0 +1,64 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE chirps
+ADD COLUMN hidden_at TIMESTAMP;
+
+ALTER TABLE users
+ADD COLUMN suspended_until TIMESTAMP;
+
+CREATE TABLE reports(
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP NOT NULL,
+  chirp_id UUID NOT NULL,
+  reporter_id UUID NOT NULL,
+  reason TEXT NOT NULL
+    CHECK (reason IN ('spam', 'harassment', 'hate', 'violence', 'misinformation', 'other')),
+  details TEXT,
+  status TEXT NOT NULL DEFAULT 'open'
+    CHECK (status IN ('open', 'resolved', 'dismissed')),
+  resolved_at TIMESTAMP,
+  resolved_by UUID,
+  UNIQUE (chirp_id, reporter_id),
+  CONSTRAINT fk_chirp_id
+    FOREIGN KEY (chirp_id)
+      REFERENCES chirps(id) ON DELETE CASCADE,
+  CONSTRAINT fk_reporter_id
+    FOREIGN KEY (reporter_id)
+      REFERENCES users(id) ON DELETE CASCADE,
+  CONSTRAINT fk_resolved_by
+    FOREIGN KEY (resolved_by)
+      REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX reports_status_created_at_idx ON reports (status, created_at);
+
+-- moderation_actions is the audit trail of moderator decisions. It doesn't
+-- reference chirps so the record survives the chirp being deleted.
+CREATE TABLE moderation_actions(
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL,
+  moderator_id UUID,
+  action TEXT NOT NULL
+    CHECK (action IN ('hide_chirp', 'suspend_user', 'dismiss')),
+  chirp_id UUID,
+  target_user_id UUID,
+  note TEXT,
+  reports_resolved INTEGER NOT NULL,
+  CONSTRAINT fk_moderator_id
+    FOREIGN KEY (moderator_id)
+      REFERENCES users(id) ON DELETE SET NULL
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE moderation_actions;
+DROP TABLE reports;
+
+ALTER TABLE users
+DROP COLUMN suspended_until;
+
+ALTER TABLE chirps
+DROP COLUMN hidden_at;
+-- +goose StatementEnd
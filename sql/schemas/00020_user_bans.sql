@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users
+ADD COLUMN banned_at TIMESTAMP,
+ADD COLUMN suspension_reason TEXT;
+
+ALTER TABLE moderation_actions
+DROP CONSTRAINT moderation_actions_action_check,
+ADD CONSTRAINT moderation_actions_action_check
+  CHECK (action IN ('hide_chirp', 'suspend_user', 'ban_user', 'unsuspend_user', 'dismiss'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM moderation_actions
+WHERE action IN ('ban_user', 'unsuspend_user');
+
+ALTER TABLE moderation_actions
+DROP CONSTRAINT moderation_actions_action_check,
+ADD CONSTRAINT moderation_actions_action_check
+  CHECK (action IN ('hide_chirp', 'suspend_user', 'dismiss'));
+
+ALTER TABLE users
+DROP COLUMN suspension_reason,
+DROP COLUMN banned_at;
+-- +goose StatementEnd
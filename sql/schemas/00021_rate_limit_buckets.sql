@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+-- rate_limit_buckets holds the token buckets when RATE_LIMIT_STORE=postgres,
+-- so every server sees the same limits.
+CREATE TABLE rate_limit_buckets(
+  key TEXT PRIMARY KEY,
+  tokens DOUBLE PRECISION NOT NULL,
+  allowed BOOLEAN NOT NULL,
+  updated_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX rate_limit_buckets_updated_at_idx ON rate_limit_buckets (updated_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE rate_limit_buckets;
+-- +goose StatementEnd
@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Shadow hidden chirps are only shown to their author.
+ALTER TABLE chirps
+ADD COLUMN shadow_hidden_at TIMESTAMP;
+
+-- Reports without a reporter are raised by the spam checks.
+ALTER TABLE reports
+ALTER COLUMN reporter_id DROP NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM reports
+WHERE reporter_id IS NULL;
+
+ALTER TABLE reports
+ALTER COLUMN reporter_id SET NOT NULL;
+
+ALTER TABLE chirps
+DROP COLUMN shadow_hidden_at;
+-- +goose StatementEnd
@@ -0,0 +1,40 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE link_previews(
+  url TEXT PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP NOT NULL,
+  status TEXT NOT NULL
+    CHECK (status IN ('pending', 'ready', 'failed')),
+  attempts INTEGER NOT NULL DEFAULT 0,
+  next_attempt_at TIMESTAMP NOT NULL,
+  fetched_at TIMESTAMP,
+  title TEXT,
+  description TEXT,
+  image_url TEXT,
+  site_name TEXT,
+  last_error TEXT
+);
+
+CREATE INDEX link_previews_pending_idx ON link_previews (next_attempt_at)
+  WHERE status = 'pending';
+
+CREATE TABLE chirp_links(
+  chirp_id UUID NOT NULL,
+  position INTEGER NOT NULL,
+  url TEXT NOT NULL,
+  PRIMARY KEY (chirp_id, position),
+  CONSTRAINT fk_chirp_id
+    FOREIGN KEY (chirp_id)
+      REFERENCES chirps(id) ON DELETE CASCADE,
+  CONSTRAINT fk_url
+    FOREIGN KEY (url)
+      REFERENCES link_previews(url) ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE chirp_links;
+DROP TABLE link_previews;
+-- +goose StatementEnd
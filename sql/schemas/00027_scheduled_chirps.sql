@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE chirps
+ADD COLUMN publish_at TIMESTAMP,
+ADD COLUMN status TEXT NOT NULL DEFAULT 'published'
+  CHECK (status IN ('scheduled', 'published'));
+
+CREATE INDEX chirps_scheduled_idx ON chirps (publish_at)
+  WHERE status = 'scheduled';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM chirps
+WHERE status = 'scheduled';
+
+DROP INDEX chirps_scheduled_idx;
+
+ALTER TABLE chirps
+DROP COLUMN status,
+DROP COLUMN publish_at;
+-- +goose StatementEnd
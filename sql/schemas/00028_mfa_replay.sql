@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+-- totp_last_step is the time step of the last TOTP code accepted, so a code
+-- can't be used again while it is still current.
+ALTER TABLE users
+ADD COLUMN totp_last_step BIGINT;
+
+-- used_mfa_tokens records MFA tokens that have been exchanged for a session
+-- until they expire, so each can only be used once.
+CREATE TABLE used_mfa_tokens(
+  id UUID PRIMARY KEY,
+  expires_at TIMESTAMP NOT NULL
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE used_mfa_tokens;
+
+ALTER TABLE users
+DROP COLUMN totp_last_step;
+-- +goose StatementEnd
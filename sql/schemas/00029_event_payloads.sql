@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+-- NOTIFY payloads are limited to 8000 bytes, so an event's data is stored
+-- here and only its ID, type and topics are sent to other servers, which
+-- load the data themselves. Rows are only needed until every server has
+-- handled the event.
+CREATE TABLE event_payloads(
+  id BIGINT PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL,
+  data JSONB NOT NULL
+);
+
+CREATE INDEX event_payloads_created_at_idx ON event_payloads (created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE event_payloads;
+-- +goose StatementEnd
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sam-maton/chirpy/internal/pubsub"
+)
+
+const (
+	streamHeartbeatInterval = 15 * time.Second
+	streamBufferSize        = 64
+)
+
+// handlerChirpStream sends chirp events as Server-Sent Events. Clients that
+// reconnect with a Last-Event-ID header are sent the events they missed.
+func (cfg *apiConfig) handlerChirpStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		respondWithError(w, "Streaming is not supported", http.StatusInternalServerError, nil)
+		return
+	}
+
+	topic := topicTimeline
+	if authorId := r.URL.Query().Get("author_id"); authorId != "" {
+		parsedId, err := uuid.Parse(authorId)
+		if err != nil {
+			respondWithError(w, "Not a valid author ID", http.StatusBadRequest, err)
+			return
+		}
+		topic = userTopic(parsedId)
+	}
+
+	var lastId uint64
+	if header := r.Header.Get("Last-Event-ID"); header != "" {
+		parsed, err := strconv.ParseUint(header, 10, 64)
+		if err != nil {
+			respondWithError(w, "Not a valid Last-Event-ID", http.StatusBadRequest, err)
+			return
+		}
+		lastId = parsed
+	}
+
+	sub, missed, complete := cfg.broker.SubscribeSince(lastId, func(e pubsub.Event) bool {
+		return e.HasTopic(topic)
+	}, streamBufferSize)
+	defer sub.Unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// Let the client know it missed events we no longer have, so it can
+	// fall back to GET /api/chirps.
+	if !complete {
+		fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	}
+	for _, e := range missed {
+		if cfg.replayHidden(r.Context(), e) {
+			continue
+		}
+		writeStreamEvent(w, e)
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-sub.C:
+			// The broker drops clients that can't keep up. They reconnect
+			// with Last-Event-ID and catch up from the history.
+			if !ok {
+				return
+			}
+			writeStreamEvent(w, e)
+			flusher.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// replayHidden reports whether a missed event should be left out when it is
+// replayed. Chirps by authors who have been banned since they posted are
+// hidden everywhere else, so they aren't replayed either.
+func (cfg *apiConfig) replayHidden(ctx context.Context, e pubsub.Event) bool {
+	if e.Type != eventChirpCreated {
+		return false
+	}
+
+	data := userEventData{}
+	err := json.Unmarshal(e.Data, &data)
+	if err != nil {
+		log.Printf("There was an error decoding a %s event: %s", e.Type, err)
+		return true
+	}
+
+	status, err := cfg.accountStatusFor(ctx, data.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return true
+	}
+	if err != nil {
+		log.Printf("There was an error checking the account status of %s: %s", data.UserID, err)
+		return true
+	}
+	return status.Banned
+}
+
+func writeStreamEvent(w http.ResponseWriter, e pubsub.Event) {
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, e.Data)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sam-maton/chirpy/internal/auth"
+	"github.com/sam-maton/chirpy/internal/database"
+)
+
+type apiTokenResponse struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	// Token is only ever set in the response to creating the token.
+	Token string `json:"token,omitempty"`
+}
+
+func (cfg *apiConfig) handlerCreateAPIToken(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	type params struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+
+	p := params{}
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&p)
+	if err != nil {
+		respondWithError(w, paramsDecodeError, http.StatusBadRequest, err)
+		return
+	}
+
+	if strings.TrimSpace(p.Name) == "" {
+		respondWithError(w, "The token needs a name", http.StatusBadRequest, nil)
+		return
+	}
+
+	scopes, err := auth.ParseScopes(p.Scopes)
+	if err != nil {
+		respondWithError(w, "Scopes must be one or more of chirps:read, chirps:write or profile:write", http.StatusBadRequest, err)
+		return
+	}
+
+	if p.ExpiresInDays < 0 {
+		respondWithError(w, "expires_in_days can't be negative", http.StatusBadRequest, nil)
+		return
+	}
+
+	// Tokens without an expiry are valid until they are revoked.
+	expiresAt := sql.NullTime{}
+	if p.ExpiresInDays > 0 {
+		expiresAt = sql.NullTime{Time: time.Now().AddDate(0, 0, p.ExpiresInDays), Valid: true}
+	}
+
+	token, err := auth.MakeAPIToken()
+	if err != nil {
+		respondWithError(w, "There was an error creating the API token", http.StatusInternalServerError, err)
+		return
+	}
+
+	apiToken, err := cfg.db.CreateAPIToken(r.Context(), database.CreateAPITokenParams{
+		UserID:    userId,
+		Name:      p.Name,
+		TokenHash: auth.HashToken(token),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		respondWithError(w, "There was an error saving the API token", http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJson(w, 201, apiTokenResponse{
+		ID:         apiToken.ID,
+		CreatedAt:  apiToken.CreatedAt,
+		Name:       apiToken.Name,
+		Scopes:     strings.Fields(apiToken.Scopes),
+		ExpiresAt:  nullTimePtr(apiToken.ExpiresAt),
+		LastUsedAt: nullTimePtr(apiToken.LastUsedAt),
+		RevokedAt:  nullTimePtr(apiToken.RevokedAt),
+		Token:      token,
+	})
+}
+
+func (cfg *apiConfig) handlerGetAPITokens(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	apiTokens, err := cfg.db.GetAPITokensByUserID(r.Context(), userId)
+	if err != nil {
+		respondWithError(w, "There was an error getting the API tokens", http.StatusInternalServerError, err)
+		return
+	}
+
+	response := []apiTokenResponse{}
+	for _, t := range apiTokens {
+		response = append(response, apiTokenResponse{
+			ID:         t.ID,
+			CreatedAt:  t.CreatedAt,
+			Name:       t.Name,
+			Scopes:     strings.Fields(t.Scopes),
+			ExpiresAt:  nullTimePtr(t.ExpiresAt),
+			LastUsedAt: nullTimePtr(t.LastUsedAt),
+			RevokedAt:  nullTimePtr(t.RevokedAt),
+		})
+	}
+
+	respondWithJson(w, 200, response)
+}
+
+func (cfg *apiConfig) handlerRevokeAPIToken(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	tokenId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, "Not a valid ID", http.StatusBadRequest, err)
+		return
+	}
+
+	revoked, err := cfg.db.RevokeAPIToken(r.Context(), database.RevokeAPITokenParams{
+		ID:     tokenId,
+		UserID: userId,
+	})
+	if err != nil {
+		respondWithError(w, "There was an error revoking the API token", http.StatusInternalServerError, err)
+		return
+	}
+
+	if revoked == 0 {
+		respondWithError(w, "API token could not be found", http.StatusNotFound, nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"errors"
+	"net/http"
 	"sort"
+	"strconv"
 
+	"github.com/sam-maton/chirpy/internal/auth"
 	"github.com/sam-maton/chirpy/internal/database"
 )
 
@@ -14,3 +18,36 @@ func sortChirpsDesc(ascChirps []database.Chirp) []database.Chirp {
 
 	return ascChirps
 }
+
+// clientIP returns the address of the client making the request.
+func (cfg *apiConfig) clientIP(r *http.Request) string {
+	return auth.ClientIP(r, cfg.trustedProxies)
+}
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// parsePagination reads the limit and offset query parameters.
+func parsePagination(r *http.Request) (limit, offset int32, err error) {
+	limit = defaultPageSize
+
+	if l := r.URL.Query().Get("limit"); l != "" {
+		parsed, err := strconv.ParseInt(l, 10, 32)
+		if err != nil || parsed < 1 || parsed > maxPageSize {
+			return 0, 0, errors.New("limit must be a number between 1 and 200")
+		}
+		limit = int32(parsed)
+	}
+
+	if o := r.URL.Query().Get("offset"); o != "" {
+		parsed, err := strconv.ParseInt(o, 10, 32)
+		if err != nil || parsed < 0 {
+			return 0, 0, errors.New("offset must be a positive number")
+		}
+		offset = int32(parsed)
+	}
+
+	return limit, offset, nil
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sam-maton/chirpy/internal/auth"
+	"github.com/sam-maton/chirpy/internal/database"
+	"github.com/sam-maton/chirpy/internal/webhooks"
+)
+
+const (
+	polkaSignatureTolerance = 5 * time.Minute
+	maxWebhookBodyBytes     = 1 << 20
+
+	defaultSubscriptionPlan   = "chirpy_red"
+	defaultSubscriptionPeriod = 30 * 24 * time.Hour
+)
+
+// Outcomes recorded for every webhook in the webhook_events table.
+const (
+	webhookProcessed = "processed"
+	webhookDuplicate = "duplicate"
+	webhookIgnored   = "ignored"
+	webhookRejected  = "rejected"
+	webhookFailed    = "failed"
+)
+
+type polkaEvent struct {
+	ID    string `json:"id"`
+	Event string `json:"event"`
+	Data  struct {
+		UserID string `json:"user_id"`
+		// Plan and CurrentPeriodEnd are only sent with upgrades and renewals.
+		Plan             string     `json:"plan"`
+		CurrentPeriodEnd *time.Time `json:"current_period_end"`
+	} `json:"data"`
+}
+
+var errInvalidWebhookUser = errors.New("webhook user ID is not valid")
+
+// WEBHOOK HANDLERS
+func (cfg *apiConfig) handlerPolkaWebhook(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBodyBytes))
+	if err != nil {
+		respondWithError(w, "There was an error reading the request body", http.StatusBadRequest, err)
+		return
+	}
+
+	// Every delivery is stored before anything else happens to it, so there
+	// is a record to investigate even when it is rejected.
+	logged, err := cfg.db.CreateWebhookEvent(r.Context(), database.CreateWebhookEventParams{
+		Source:   "polka",
+		Headers:  webhookHeadersJSON(r.Header),
+		Body:     body,
+		ReplayOf: uuid.NullUUID{},
+	})
+	if err != nil {
+		respondWithError(w, "There was an error storing the webhook", http.StatusInternalServerError, err)
+		return
+	}
+
+	err = auth.VerifyWebhookSignature(
+		body,
+		r.Header.Get("X-Polka-Timestamp"),
+		r.Header.Get("X-Polka-Signature"),
+		cfg.polkaKeys,
+		polkaSignatureTolerance,
+		time.Now(),
+	)
+	if err != nil {
+		cfg.recordWebhookOutcome(r.Context(), logged.ID, false, polkaEvent{}, webhookRejected, err)
+		respondWithError(w, "The webhook signature is not valid", http.StatusUnauthorized, err)
+		return
+	}
+
+	outcome, err := cfg.handlePolkaEvent(r.Context(), logged.ID, body, false)
+	switch outcome {
+	case webhookRejected:
+		respondWithError(w, "The webhook payload is not valid", http.StatusBadRequest, err)
+	case webhookFailed:
+		respondWithError(w, "There was an issue processing the webhook", http.StatusInternalServerError, err)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handlePolkaEvent parses and processes a webhook whose signature has already
+// been checked, and records the outcome against the stored webhook.
+func (cfg *apiConfig) handlePolkaEvent(ctx context.Context, logId uuid.UUID, body []byte, replay bool) (string, error) {
+	event := polkaEvent{}
+	err := json.Unmarshal(body, &event)
+	if err != nil {
+		cfg.recordWebhookOutcome(ctx, logId, true, event, webhookRejected, err)
+		return webhookRejected, err
+	}
+
+	if event.ID == "" {
+		err = errors.New("webhook has no event ID")
+		cfg.recordWebhookOutcome(ctx, logId, true, event, webhookRejected, err)
+		return webhookRejected, err
+	}
+
+	outcome, err := cfg.processPolkaEvent(ctx, event, replay)
+	if errors.Is(err, errInvalidWebhookUser) {
+		outcome = webhookRejected
+	} else if err != nil {
+		outcome = webhookFailed
+	}
+
+	cfg.recordWebhookOutcome(ctx, logId, true, event, outcome, err)
+	return outcome, err
+}
+
+func (cfg *apiConfig) recordWebhookOutcome(ctx context.Context, logId uuid.UUID, signatureValid bool, event polkaEvent, outcome string, processErr error) {
+	errMessage := sql.NullString{}
+	if processErr != nil {
+		errMessage = sql.NullString{String: processErr.Error(), Valid: true}
+	}
+
+	err := cfg.db.UpdateWebhookEventOutcome(ctx, database.UpdateWebhookEventOutcomeParams{
+		ID:             logId,
+		SignatureValid: signatureValid,
+		EventID:        sql.NullString{String: event.ID, Valid: event.ID != ""},
+		EventType:      sql.NullString{String: event.Event, Valid: event.Event != ""},
+		Outcome:        outcome,
+		Error:          errMessage,
+	})
+	if err != nil {
+		log.Printf("There was an error recording the webhook outcome: %s", err)
+	}
+}
+
+// webhookHeadersJSON returns the request headers for storing, with any
+// credentials left out.
+func webhookHeadersJSON(headers http.Header) json.RawMessage {
+	stored := http.Header{}
+	for k, v := range headers {
+		switch strings.ToLower(k) {
+		case "authorization", "cookie":
+			stored[k] = []string{"[redacted]"}
+		default:
+			stored[k] = v
+		}
+	}
+
+	dat, err := json.Marshal(stored)
+	if err != nil {
+		return json.RawMessage("{}")
+	}
+	return dat
+}
+
+// processPolkaEvent applies a webhook event at most once. The event ID is
+// recorded in the same transaction as the event's changes, so a delivery that
+// fails part way can be retried and a duplicate delivery is a no-op. Replays
+// started by an admin skip the duplicate check on purpose.
+func (cfg *apiConfig) processPolkaEvent(ctx context.Context, event polkaEvent, replay bool) (string, error) {
+	tx, err := cfg.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return webhookFailed, err
+	}
+	defer tx.Rollback()
+
+	qtx := cfg.db.WithTx(tx)
+
+	inserted, err := qtx.MarkWebhookEventProcessed(ctx, database.MarkWebhookEventProcessedParams{
+		EventID:   event.ID,
+		EventType: event.Event,
+	})
+	if err != nil {
+		return webhookFailed, err
+	}
+	if inserted == 0 && !replay {
+		return webhookDuplicate, nil
+	}
+
+	handled, err := applySubscriptionEvent(ctx, qtx, event)
+	if err != nil {
+		return webhookFailed, err
+	}
+
+	if handled && event.Event == "user.upgraded" {
+		userId, _ := uuid.Parse(event.Data.UserID)
+		err = cfg.enqueueWebhookEvent(ctx, qtx, userId, webhooks.EventUserUpgraded, struct {
+			UserID           uuid.UUID  `json:"user_id"`
+			Plan             string     `json:"plan"`
+			CurrentPeriodEnd *time.Time `json:"current_period_end"`
+		}{
+			UserID:           userId,
+			Plan:             event.Data.Plan,
+			CurrentPeriodEnd: event.Data.CurrentPeriodEnd,
+		})
+		if err != nil {
+			return webhookFailed, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return webhookFailed, err
+	}
+
+	if !handled {
+		return webhookIgnored, nil
+	}
+
+	userId, _ := uuid.Parse(event.Data.UserID)
+	cfg.publishUserUpdated(ctx, userId)
+	cfg.publishNotification(ctx, userId, eventSubscriptionUpdated, struct {
+		Event string `json:"event"`
+	}{
+		Event: event.Event,
+	})
+
+	return webhookProcessed, nil
+}
+
+// applySubscriptionEvent updates the user's subscription for the Polka events
+// that change it. Other events, and events for users that don't exist, are
+// ignored and reported as not handled so Polka doesn't keep retrying them.
+func applySubscriptionEvent(ctx context.Context, qtx *database.Queries, event polkaEvent) (bool, error) {
+	switch event.Event {
+	case "user.upgraded", "user.renewed", "user.downgraded", "user.payment_failed", "user.refunded":
+	default:
+		return false, nil
+	}
+
+	userId, err := uuid.Parse(event.Data.UserID)
+	if err != nil {
+		return false, errInvalidWebhookUser
+	}
+
+	_, err = qtx.GetUserByID(ctx, userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	switch event.Event {
+	case "user.upgraded", "user.renewed":
+		plan := event.Data.Plan
+		if plan == "" {
+			plan = defaultSubscriptionPlan
+		}
+
+		periodEnd := time.Now().Add(defaultSubscriptionPeriod)
+		if event.Data.CurrentPeriodEnd != nil {
+			periodEnd = *event.Data.CurrentPeriodEnd
+		}
+
+		_, err = qtx.UpsertSubscription(ctx, database.UpsertSubscriptionParams{
+			UserID:           userId,
+			Plan:             plan,
+			CurrentPeriodEnd: periodEnd,
+		})
+	case "user.downgraded":
+		// The user keeps Chirpy Red until the end of the period they paid for.
+		_, err = qtx.SetSubscriptionStatus(ctx, database.SetSubscriptionStatusParams{
+			UserID: userId,
+			Status: "canceled",
+		})
+	case "user.payment_failed":
+		_, err = qtx.SetSubscriptionStatus(ctx, database.SetSubscriptionStatusParams{
+			UserID: userId,
+			Status: "past_due",
+		})
+	case "user.refunded":
+		_, err = qtx.EndSubscription(ctx, database.EndSubscriptionParams{
+			UserID: userId,
+			Status: "refunded",
+		})
+	}
+
+	// A status change for a user without a subscription has nothing to update.
+	if errors.Is(err, sql.ErrNoRows) {
+		return true, nil
+	}
+
+	return true, err
+}
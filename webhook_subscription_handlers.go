@@ -0,0 +1,222 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sam-maton/chirpy/internal/auth"
+	"github.com/sam-maton/chirpy/internal/database"
+	"github.com/sam-maton/chirpy/internal/netguard"
+	"github.com/sam-maton/chirpy/internal/webhooks"
+)
+
+type webhookSubscriptionResponse struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	IsGlobal  bool      `json:"is_global"`
+	// Secret is only ever set in the response to creating the subscription.
+	Secret string `json:"secret,omitempty"`
+}
+
+type webhookDeliveryResponse struct {
+	ID             uuid.UUID       `json:"id"`
+	CreatedAt      time.Time       `json:"created_at"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int32           `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at"`
+	ResponseStatus *int32          `json:"response_status"`
+	LastError      *string         `json:"last_error"`
+}
+
+func (cfg *apiConfig) handlerCreateWebhookSubscription(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	type params struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+		Global bool     `json:"global"`
+	}
+
+	p := params{}
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&p)
+	if err != nil {
+		respondWithError(w, paramsDecodeError, http.StatusBadRequest, err)
+		return
+	}
+
+	target, err := url.Parse(p.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		respondWithError(w, "url must be an absolute http or https URL", http.StatusBadRequest, err)
+		return
+	}
+	// Hostnames that resolve to internal addresses are caught when the
+	// webhook is delivered.
+	if netguard.IsBlockedHost(target.Hostname()) {
+		respondWithError(w, "url must not point to a private or local address", http.StatusBadRequest, nil)
+		return
+	}
+
+	events, err := webhooks.ParseEvents(p.Events)
+	if err != nil {
+		respondWithError(w, "Events must be one or more of chirp.created, chirp.deleted or user.upgraded", http.StatusBadRequest, err)
+		return
+	}
+
+	// Global subscriptions see every user's events so only admins can
+	// create them.
+	if p.Global {
+		user, err := cfg.db.GetUserByID(r.Context(), userId)
+		if err != nil {
+			respondWithError(w, "There was an error getting the user", http.StatusInternalServerError, err)
+			return
+		}
+		if !auth.Role(user.Role).Satisfies(auth.RoleAdmin) {
+			respondWithError(w, "Only admins can create global webhooks", http.StatusForbidden, nil)
+			return
+		}
+	}
+
+	secret, err := webhooks.MakeSecret()
+	if err != nil {
+		respondWithError(w, "There was an error creating the webhook secret", http.StatusInternalServerError, err)
+		return
+	}
+
+	subscription, err := cfg.db.CreateWebhookSubscription(r.Context(), database.CreateWebhookSubscriptionParams{
+		UserID:   userId,
+		Url:      target.String(),
+		Secret:   secret,
+		Events:   events,
+		IsGlobal: p.Global,
+	})
+	if err != nil {
+		respondWithError(w, "There was an error saving the webhook", http.StatusInternalServerError, err)
+		return
+	}
+
+	response := webhookSubscriptionToResponse(subscription)
+	response.Secret = subscription.Secret
+	respondWithJson(w, 201, response)
+}
+
+func (cfg *apiConfig) handlerGetWebhookSubscriptions(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	subscriptions, err := cfg.db.GetWebhookSubscriptionsByUserID(r.Context(), userId)
+	if err != nil {
+		respondWithError(w, "There was an error getting the webhooks", http.StatusInternalServerError, err)
+		return
+	}
+
+	response := []webhookSubscriptionResponse{}
+	for _, s := range subscriptions {
+		response = append(response, webhookSubscriptionToResponse(s))
+	}
+
+	respondWithJson(w, 200, response)
+}
+
+func (cfg *apiConfig) handlerDeleteWebhookSubscription(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	subscriptionId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, "Not a valid ID", http.StatusBadRequest, err)
+		return
+	}
+
+	deleted, err := cfg.db.DeleteWebhookSubscription(r.Context(), database.DeleteWebhookSubscriptionParams{
+		ID:     subscriptionId,
+		UserID: userId,
+	})
+	if err != nil {
+		respondWithError(w, "There was an error deleting the webhook", http.StatusInternalServerError, err)
+		return
+	}
+
+	if deleted == 0 {
+		respondWithError(w, "Webhook could not be found", http.StatusNotFound, nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerGetWebhookDeliveries(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	subscriptionId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, "Not a valid ID", http.StatusBadRequest, err)
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	subscription, err := cfg.db.GetWebhookSubscriptionByID(r.Context(), subscriptionId)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && subscription.UserID != userId) {
+		respondWithError(w, "Webhook could not be found", http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, "There was an error getting the webhook", http.StatusInternalServerError, err)
+		return
+	}
+
+	deliveries, err := cfg.db.GetWebhookDeliveriesBySubscriptionID(r.Context(), database.GetWebhookDeliveriesBySubscriptionIDParams{
+		SubscriptionID: subscription.ID,
+		Limit:          limit,
+		Offset:         offset,
+	})
+	if err != nil {
+		respondWithError(w, "There was an error getting the webhook deliveries", http.StatusInternalServerError, err)
+		return
+	}
+
+	response := []webhookDeliveryResponse{}
+	for _, d := range deliveries {
+		// Deliveries that are finished won't be tried again.
+		var nextAttemptAt *time.Time
+		if d.Status == "pending" {
+			nextAttemptAt = &d.NextAttemptAt
+		}
+
+		var responseStatus *int32
+		if d.ResponseStatus.Valid {
+			responseStatus = &d.ResponseStatus.Int32
+		}
+
+		response = append(response, webhookDeliveryResponse{
+			ID:             d.ID,
+			CreatedAt:      d.CreatedAt,
+			EventType:      d.EventType,
+			Payload:        d.Payload,
+			Status:         d.Status,
+			Attempts:       d.Attempts,
+			NextAttemptAt:  nextAttemptAt,
+			DeliveredAt:    nullTimePtr(d.DeliveredAt),
+			ResponseStatus: responseStatus,
+			LastError:      nullStringPtr(d.LastError),
+		})
+	}
+
+	respondWithJson(w, 200, response)
+}
+
+func webhookSubscriptionToResponse(s database.WebhookSubscription) webhookSubscriptionResponse {
+	return webhookSubscriptionResponse{
+		ID:        s.ID,
+		CreatedAt: s.CreatedAt,
+		URL:       s.Url,
+		Events:    strings.Fields(s.Events),
+		IsGlobal:  s.IsGlobal,
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gorilla/websocket"
+	"github.com/sam-maton/chirpy/internal/auth"
+)
+
+const maxSocketsPerUser = 5
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// handlerWebSocket upgrades to the real-time WebSocket API. Browsers can't set
+// headers on a WebSocket request, so the JWT can also be passed as ?token=.
+func (cfg *apiConfig) handlerWebSocket(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		headerToken, err := auth.GetBearerToken(r.Header)
+		if err != nil {
+			respondWithError(w, "There was no auth token in the header", http.StatusUnauthorized, err)
+			return
+		}
+		token = headerToken
+	}
+
+	userId, expiresAt, err := auth.ValidateJWTExpiry(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, "Invalid auth token", http.StatusUnauthorized, err)
+		return
+	}
+
+	status, err := cfg.accountStatusFor(r.Context(), userId)
+	if err != nil {
+		respondWithError(w, "Invalid auth token", http.StatusUnauthorized, err)
+		return
+	}
+	if rejectDisabledAccount(w, status) {
+		return
+	}
+
+	if !cfg.realtime.Acquire(userId) {
+		respondWithError(w, "Too many open connections", http.StatusTooManyRequests, nil)
+		return
+	}
+	defer cfg.realtime.Release(userId)
+
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already written an error response.
+		return
+	}
+
+	// Suspending or banning the user closes the socket through
+	// disconnectIfDisabled, and it is closed when the token expires.
+	cfg.realtime.Serve(conn, userId, expiresAt)
+}